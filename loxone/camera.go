@@ -0,0 +1,150 @@
+package loxone
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultImageRefresh is the default interval after which a cached camera image is fetched again.
+const DefaultImageRefresh = 10 * time.Second
+
+// Camera fetches still images from an Intercom or camera control.
+type Camera struct {
+	UUID       UUID
+	Name       string
+	socket     *WebSocket
+	imageURL   url.URL
+	streamURL  url.URL
+	user, pass string
+	httpClient *http.Client
+	mutex      *sync.Mutex
+	refresh    time.Duration
+	image      []byte
+	fetched    time.Time
+}
+
+// Camera returns the camera of the control with the given uuid.
+func (socket *WebSocket) Camera(app3 map[string]interface{}, uuid UUID) (camera *Camera, err error) {
+	controls, _ := app3["controls"].(map[string]interface{})
+	control, ok := controls[string(uuid)].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unknown control %s", uuid)
+	}
+	details, _ := control["details"].(map[string]interface{})
+	video, ok := details["videoInfo"].(map[string]interface{})
+	if !ok {
+		video = details
+	}
+	alertImage, _ := video["alertImage"].(string)
+	streamURL, _ := video["streamUrl"].(string)
+	if alertImage == "" && streamURL == "" {
+		return nil, fmt.Errorf("control %s has no image", uuid)
+	}
+
+	base := url.URL{Scheme: "http", Host: socket.host}
+	camera = &Camera{UUID: uuid, socket: socket, httpClient: &http.Client{Timeout: 10 * time.Second}, mutex: &sync.Mutex{}, refresh: DefaultImageRefresh}
+	camera.Name, _ = control["name"].(string)
+	camera.user, _ = video["user"].(string)
+	camera.pass, _ = video["pass"].(string)
+	if alertImage != "" {
+		if u, err := base.Parse(alertImage); err == nil {
+			camera.imageURL = *u
+		}
+	}
+	if streamURL != "" {
+		if u, err := base.Parse(streamURL); err == nil {
+			camera.streamURL = *u
+		}
+	}
+	if camera.imageURL.Host == "" && (camera.streamURL.Scheme == "http" || camera.streamURL.Scheme == "https") {
+		camera.imageURL = camera.streamURL
+	}
+	if camera.imageURL.Host == "" {
+		return nil, fmt.Errorf("control %s has no image", uuid)
+	}
+	return camera, err
+}
+
+// SetRefreshInterval sets the interval after which the cached image is fetched again.
+func (camera *Camera) SetRefreshInterval(refresh time.Duration) {
+	camera.mutex.Lock()
+	defer camera.mutex.Unlock()
+	camera.refresh = refresh
+}
+
+// StreamURL returns the URL of the video stream, if any.
+func (camera *Camera) StreamURL() string {
+	if camera.streamURL.Host == "" {
+		return ""
+	}
+	return camera.streamURL.String()
+}
+
+// Image returns the current still image, fetching it when the cached image is outdated.
+// For controls with a MJPEG stream only, the image is the first frame of the stream.
+// If fetching fails, the last cached image is returned along with the error.
+func (camera *Camera) Image() (image []byte, err error) {
+	camera.mutex.Lock()
+	defer camera.mutex.Unlock()
+	if camera.image == nil || time.Since(camera.fetched) >= camera.refresh {
+		image, err = camera.fetch()
+		if err == nil {
+			camera.image = image
+			camera.fetched = time.Now()
+		}
+	}
+	return camera.image, err
+}
+
+func (camera *Camera) fetch() (image []byte, err error) {
+	imageURL := camera.imageURL
+	if camera.user == "" && imageURL.Host == camera.socket.host {
+		var auth url.Values
+		auth, err = camera.socket.authQuery()
+		if err != nil {
+			return nil, err
+		}
+		query := imageURL.Query()
+		for k, v := range auth {
+			query[k] = v
+		}
+		imageURL.RawQuery = query.Encode()
+	}
+	req, err := http.NewRequest("GET", imageURL.String(), nil)
+	if err == nil {
+		if camera.user != "" {
+			req.SetBasicAuth(camera.user, camera.pass)
+		}
+		var resp *http.Response
+		resp, err = camera.httpClient.Do(req)
+		if err == nil {
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("invalid image response status %s", resp.Status)
+			} else {
+				image, err = readImage(resp)
+			}
+		}
+	}
+	return image, err
+}
+
+// readImage reads the image of the response, which is the first part of multipart MJPEG streams.
+func readImage(resp *http.Response) (image []byte, err error) {
+	mediaType, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return ioutil.ReadAll(resp.Body)
+	}
+	part, err := multipart.NewReader(resp.Body, params["boundary"]).NextPart()
+	if err == nil {
+		image, err = ioutil.ReadAll(part)
+	}
+	return image, err
+}
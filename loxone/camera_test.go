@@ -0,0 +1,91 @@
+package loxone
+
+import (
+	"crypto/sha1"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCameraStreamImage(t *testing.T) {
+	frame := []byte("\xff\xd8jpeg frame\xff\xd9")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mw.Boundary())
+		for {
+			part, _ := mw.CreatePart(map[string][]string{"Content-Type": {"image/jpeg"}})
+			part.Write(frame)
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}))
+	defer server.Close()
+
+	streamURL, _ := url.Parse(server.URL + "/mjpg/video.mjpg")
+	camera := &Camera{
+		socket:     &WebSocket{},
+		imageURL:   *streamURL,
+		user:       "admin",
+		pass:       "secret",
+		httpClient: &http.Client{Timeout: time.Second},
+		mutex:      &sync.Mutex{},
+		refresh:    DefaultImageRefresh,
+	}
+	image, err := camera.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(image) != string(frame) {
+		t.Errorf("image = %q, want %q", image, frame)
+	}
+}
+
+func TestCameraImageQuery(t *testing.T) {
+	image := []byte("\xff\xd8jpeg image\xff\xd9")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("resolution") != "640" || query.Get("autht") != testHMAC(sha1.New, "1234", "8E2AA590") || query.Get("user") != "admin" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(image)
+	}))
+	defer server.Close()
+
+	_, socket := newTestMiniserver(t, func(cmd string) (int, interface{}) {
+		return 200, "31323334"
+	})
+	imageURL, _ := url.Parse(server.URL + "/camimage/" + string(testUUIDString) + "?resolution=640")
+	socket.host = imageURL.Host
+	camera := &Camera{
+		socket:     socket,
+		imageURL:   *imageURL,
+		httpClient: &http.Client{Timeout: time.Second},
+		mutex:      &sync.Mutex{},
+		refresh:    DefaultImageRefresh,
+	}
+	if _, err := camera.Image(); err == nil {
+		t.Error("expected error without session token")
+	}
+	socket.username, socket.token = "admin", token{Token: "8E2AA590"}
+	got, err := camera.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(image) {
+		t.Errorf("image = %q, want %q", got, image)
+	}
+}
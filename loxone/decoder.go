@@ -0,0 +1,204 @@
+package loxone
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	uuidSize            = 16
+	valueEventSize      = 24
+	textEventHeaderSize = 36
+	daytimerHeaderSize  = 28
+	daytimerEntrySize   = 24
+	weatherHeaderSize   = 24
+	weatherEntrySize    = 68
+)
+
+const hexDigits = "0123456789abcdef"
+
+// maxCachedUUIDs bounds the number of UUIDs a decoder keeps around.
+const maxCachedUUIDs = 1 << 16
+
+// decoder decodes binary event tables. It keeps the decoded UUIDs and the
+// last table around so that subsequent frames can be decoded without
+// allocating. A decoder must not be used concurrently.
+type decoder struct {
+	uuids map[[uuidSize]byte]UUID
+	table map[UUID]interface{}
+}
+
+func newDecoder() *decoder {
+	return &decoder{make(map[[uuidSize]byte]UUID), make(map[UUID]interface{})}
+}
+
+// uuid decodes the UUID at the beginning of msg, reusing previously decoded ones.
+func (dec *decoder) uuid(msg []byte) (uuid UUID, err error) {
+	if len(msg) < uuidSize {
+		return uuid, fmt.Errorf("invalid uuid length")
+	}
+	var key [uuidSize]byte
+	copy(key[:], msg)
+	uuid, ok := dec.uuids[key]
+	if !ok {
+		uuid, err = decodeUUID(key[:])
+		if len(dec.uuids) < maxCachedUUIDs {
+			dec.uuids[key] = uuid
+		}
+	}
+	return uuid, err
+}
+
+// reset clears and returns the reusable table. The table is only valid until the next call.
+func (dec *decoder) reset() map[UUID]interface{} {
+	for k := range dec.table {
+		delete(dec.table, k)
+	}
+	return dec.table
+}
+
+func (dec *decoder) decodeValueEventTable(msg []byte) (table map[UUID]interface{}, err error) {
+	table = dec.reset()
+	if len(msg)%valueEventSize != 0 {
+		return table, fmt.Errorf("invalid value event table length %d", len(msg))
+	}
+	for i := 0; i < len(msg); i += valueEventSize {
+		uuid, err := dec.uuid(msg[i:])
+		if err != nil {
+			return table, err
+		}
+		table[uuid] = readFloat64(msg[i+16:])
+	}
+	return table, nil
+}
+
+func (dec *decoder) decodeTextEventTable(msg []byte) (table map[UUID]interface{}, err error) {
+	table = dec.reset()
+	for i := 0; i < len(msg); {
+		if len(msg)-i < textEventHeaderSize {
+			return table, fmt.Errorf("invalid text event length %d", len(msg)-i)
+		}
+		uuid, err := dec.uuid(msg[i:])
+		if err != nil {
+			return table, err
+		}
+		textLength := int(binary.LittleEndian.Uint32(msg[i+32:]))
+		i += textEventHeaderSize
+		if textLength < 0 || textLength > len(msg)-i {
+			return table, fmt.Errorf("invalid text event with length %d", textLength)
+		}
+		table[uuid] = string(msg[i : i+textLength])
+		i += textLength + (4-textLength%4)%4
+	}
+	return table, nil
+}
+
+func (dec *decoder) decodeDaytimerEventTable(msg []byte) (table map[UUID]interface{}, err error) {
+	table = dec.reset()
+	for i := 0; i < len(msg); {
+		if len(msg)-i < daytimerHeaderSize {
+			return table, fmt.Errorf("invalid daytimer event length %d", len(msg)-i)
+		}
+		uuid, err := dec.uuid(msg[i:])
+		if err != nil {
+			return table, err
+		}
+		defaultVal := readFloat64(msg[i+16:])
+		nrEntries := int32(binary.LittleEndian.Uint32(msg[i+24:]))
+		i += daytimerHeaderSize
+		if nrEntries < 0 || int(nrEntries) > (len(msg)-i)/daytimerEntrySize {
+			return table, fmt.Errorf("invalid daytimer event with %d entries", nrEntries)
+		}
+		entries := make([]DayTimerEntry, nrEntries)
+		for n := range entries {
+			entries[n] = decodeDaytimerEntry(msg[i:])
+			i += daytimerEntrySize
+		}
+		table[uuid] = DayTimerEvent{defaultVal, entries}
+	}
+	return table, nil
+}
+
+func (dec *decoder) decodeWeatherEventTable(msg []byte) (table map[UUID]interface{}, err error) {
+	table = dec.reset()
+	for i := 0; i < len(msg); {
+		if len(msg)-i < weatherHeaderSize {
+			return table, fmt.Errorf("invalid weather event length %d", len(msg)-i)
+		}
+		uuid, err := dec.uuid(msg[i:])
+		if err != nil {
+			return table, err
+		}
+		lastUpdate := binary.LittleEndian.Uint32(msg[i+16:])
+		nrEntries := int32(binary.LittleEndian.Uint32(msg[i+20:]))
+		i += weatherHeaderSize
+		if nrEntries < 0 || int(nrEntries) > (len(msg)-i)/weatherEntrySize {
+			return table, fmt.Errorf("invalid weather event with %d entries", nrEntries)
+		}
+		entries := make([]WeatherEntry, nrEntries)
+		for n := range entries {
+			entries[n] = decodeWeatherEntry(msg[i:])
+			i += weatherEntrySize
+		}
+		table[uuid] = WeatherEvent{lastUpdate, entries}
+	}
+	return table, nil
+}
+
+// decodeUUID formats the 16 bytes of a Miniserver UUID.
+func decodeUUID(msg []byte) (uuid UUID, err error) {
+	if len(msg) != uuidSize {
+		return uuid, fmt.Errorf("invalid uuid length")
+	}
+	var buf [35]byte
+	putHex(buf[0:], msg[3], msg[2], msg[1], msg[0])
+	buf[8] = '-'
+	putHex(buf[9:], msg[5], msg[4])
+	buf[13] = '-'
+	putHex(buf[14:], msg[7], msg[6])
+	buf[18] = '-'
+	putHex(buf[19:], msg[8:16]...)
+	return UUID(buf[:]), nil
+}
+
+// decodeDaytimerEntry decodes a daytimer entry, msg must hold at least daytimerEntrySize bytes.
+func decodeDaytimerEntry(msg []byte) DayTimerEntry {
+	_ = msg[daytimerEntrySize-1]
+	return DayTimerEntry{
+		mode:         int32(binary.LittleEndian.Uint32(msg[0:])),
+		from:         int32(binary.LittleEndian.Uint32(msg[4:])),
+		to:           int32(binary.LittleEndian.Uint32(msg[8:])),
+		needActivate: int32(binary.LittleEndian.Uint32(msg[12:])),
+		val:          readFloat64(msg[16:]),
+	}
+}
+
+// decodeWeatherEntry decodes a weather entry, msg must hold at least weatherEntrySize bytes.
+func decodeWeatherEntry(msg []byte) WeatherEntry {
+	_ = msg[weatherEntrySize-1]
+	return WeatherEntry{
+		timestamp:            int32(binary.LittleEndian.Uint32(msg[0:])),
+		weatherType:          int32(binary.LittleEndian.Uint32(msg[4:])),
+		windDirection:        int32(binary.LittleEndian.Uint32(msg[8:])),
+		solarRadiation:       int32(binary.LittleEndian.Uint32(msg[12:])),
+		relativeHumidity:     int32(binary.LittleEndian.Uint32(msg[16:])),
+		temperature:          readFloat64(msg[20:]),
+		perceivedTemperature: readFloat64(msg[28:]),
+		dewPoint:             readFloat64(msg[36:]),
+		pricipitation:        readFloat64(msg[44:]),
+		windSpeed:            readFloat64(msg[52:]),
+		barometicPressure:    readFloat64(msg[60:]),
+	}
+}
+
+func readFloat64(msg []byte) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(msg))
+}
+
+func putHex(dst []byte, src ...byte) {
+	for i, b := range src {
+		dst[i*2] = hexDigits[b>>4]
+		dst[i*2+1] = hexDigits[b&0x0f]
+	}
+}
@@ -0,0 +1,246 @@
+package loxone
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+var testUUID = []byte{0x73, 0x67, 0x6e, 0x10, 0xa9, 0x02, 0x41, 0xe6, 0xff, 0xff, 0x20, 0xdf, 0x2f, 0xc4, 0xe7, 0x8a}
+
+const testUUIDString = UUID("106e6773-02a9-e641-ffff20df2fc4e78a")
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendFloat64(b []byte, v float64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(b, buf[:]...)
+}
+
+func valueEventTable(n int) (msg []byte) {
+	for i := 0; i < n; i++ {
+		uuid := append([]byte(nil), testUUID...)
+		binary.LittleEndian.PutUint16(uuid[14:], uint16(i))
+		msg = append(msg, uuid...)
+		msg = appendFloat64(msg, float64(i))
+	}
+	return msg
+}
+
+func textEventTable(texts ...string) (msg []byte) {
+	for i, text := range texts {
+		uuid := append([]byte(nil), testUUID...)
+		binary.LittleEndian.PutUint16(uuid[14:], uint16(i))
+		msg = append(msg, uuid...)
+		msg = append(msg, testUUID...)
+		msg = appendUint32(msg, uint32(len(text)))
+		msg = append(msg, text...)
+		for len(text)%4 != 0 {
+			msg = append(msg, 0)
+			text += " "
+		}
+	}
+	return msg
+}
+
+func daytimerEventTable(n int) (msg []byte) {
+	msg = append(msg, testUUID...)
+	msg = appendFloat64(msg, 21.5)
+	msg = appendUint32(msg, uint32(n))
+	for i := 0; i < n; i++ {
+		msg = appendUint32(msg, 1)
+		msg = appendUint32(msg, uint32(i*60))
+		msg = appendUint32(msg, uint32(i*60+30))
+		msg = appendUint32(msg, 0)
+		msg = appendFloat64(msg, float64(i))
+	}
+	return msg
+}
+
+func weatherEventTable(n int) (msg []byte) {
+	msg = append(msg, testUUID...)
+	msg = appendUint32(msg, 1234)
+	msg = appendUint32(msg, uint32(n))
+	for i := 0; i < n; i++ {
+		for j := 0; j < 5; j++ {
+			msg = appendUint32(msg, uint32(i+j))
+		}
+		for j := 0; j < 6; j++ {
+			msg = appendFloat64(msg, float64(i*j))
+		}
+	}
+	return msg
+}
+
+func TestDecodeUUID(t *testing.T) {
+	uuid, err := decodeUUID(testUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uuid != testUUIDString {
+		t.Errorf("got %s, want %s", uuid, testUUIDString)
+	}
+	if _, err := decodeUUID(testUUID[:15]); err == nil {
+		t.Error("expected error for truncated uuid")
+	}
+}
+
+func TestDecodeValueEventTable(t *testing.T) {
+	msg := appendFloat64(append([]byte(nil), testUUID...), 42)
+	table, err := newDecoder().decodeValueEventTable(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(table, map[UUID]interface{}{testUUIDString: 42.0}) {
+		t.Errorf("unexpected table %v", table)
+	}
+	if _, err := newDecoder().decodeValueEventTable(msg[:20]); err == nil {
+		t.Error("expected error for truncated table")
+	}
+}
+
+func TestDecodeTextEventTable(t *testing.T) {
+	msg := textEventTable("abcde", "fgh")
+	table, err := newDecoder().decodeTextEventTable(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[UUID]interface{}{
+		UUID("106e6773-02a9-e641-ffff20df2fc40000"): "abcde",
+		UUID("106e6773-02a9-e641-ffff20df2fc40100"): "fgh",
+	}
+	if !reflect.DeepEqual(table, want) {
+		t.Errorf("unexpected table %v", table)
+	}
+	if _, err := newDecoder().decodeTextEventTable(msg[:40]); err == nil {
+		t.Error("expected error for truncated text")
+	}
+}
+
+func TestDecodeDaytimerEventTable(t *testing.T) {
+	table, err := newDecoder().decodeDaytimerEventTable(daytimerEventTable(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := table[testUUIDString].(DayTimerEvent)
+	if event.defaultVal != 21.5 || len(event.entries) != 3 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if want := (DayTimerEntry{1, 120, 150, 0, 2}); event.entries[2] != want {
+		t.Errorf("got %+v, want %+v", event.entries[2], want)
+	}
+}
+
+func TestDecodeWeatherEventTable(t *testing.T) {
+	table, err := newDecoder().decodeWeatherEventTable(weatherEventTable(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := table[testUUIDString].(WeatherEvent)
+	if event.lastUpdate != 1234 || len(event.entries) != 2 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if want := (WeatherEntry{1, 2, 3, 4, 5, 0, 1, 2, 3, 4, 5}); event.entries[1] != want {
+		t.Errorf("got %+v, want %+v", event.entries[1], want)
+	}
+}
+
+func TestDecodeTruncatedEntries(t *testing.T) {
+	msg := daytimerEventTable(2)
+	if _, err := newDecoder().decodeDaytimerEventTable(msg[:len(msg)-1]); err == nil {
+		t.Error("expected error for truncated daytimer entries")
+	}
+	msg = weatherEventTable(2)
+	if _, err := newDecoder().decodeWeatherEventTable(msg[:len(msg)-1]); err == nil {
+		t.Error("expected error for truncated weather entries")
+	}
+}
+
+func BenchmarkDecodeValueEventTable(b *testing.B) {
+	msg := valueEventTable(5000)
+	dec := newDecoder()
+	b.SetBytes(int64(len(msg)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := dec.decodeValueEventTable(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeTextEventTable(b *testing.B) {
+	var msg []byte
+	for i := 0; i < 1000; i++ {
+		msg = append(msg, textEventTable("living room light on")...)
+	}
+	dec := newDecoder()
+	b.SetBytes(int64(len(msg)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := dec.decodeTextEventTable(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeDaytimerEventTable(b *testing.B) {
+	msg := daytimerEventTable(1000)
+	dec := newDecoder()
+	b.SetBytes(int64(len(msg)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := dec.decodeDaytimerEventTable(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeWeatherEventTable(b *testing.B) {
+	msg := weatherEventTable(1000)
+	dec := newDecoder()
+	b.SetBytes(int64(len(msg)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := dec.decodeWeatherEventTable(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func FuzzDecodeValueEventTable(f *testing.F) {
+	f.Add(valueEventTable(2))
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		newDecoder().decodeValueEventTable(msg)
+	})
+}
+
+func FuzzDecodeTextEventTable(f *testing.F) {
+	f.Add(textEventTable("abcde", "fgh"))
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		newDecoder().decodeTextEventTable(msg)
+	})
+}
+
+func FuzzDecodeDaytimerEventTable(f *testing.F) {
+	f.Add(daytimerEventTable(2))
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		newDecoder().decodeDaytimerEventTable(msg)
+	})
+}
+
+func FuzzDecodeWeatherEventTable(f *testing.F) {
+	f.Add(weatherEventTable(2))
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		newDecoder().decodeWeatherEventTable(msg)
+	})
+}
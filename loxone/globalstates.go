@@ -0,0 +1,443 @@
+package loxone
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// calendarPeriod is the calendar mode for entries spanning a range of days.
+	calendarPeriod = 4
+	// calendarDateFormat is the format of the calendar entry dates, without path separators.
+	calendarDateFormat = "2006-01-02"
+	// operatingModeEntryName is the name of the calendar entry used by SetOperatingMode.
+	operatingModeEntryName = "couchpotatoe"
+)
+
+// loxoneEpoch is the reference date of Miniserver timestamps.
+var loxoneEpoch = time.Date(2009, 1, 1, 0, 0, 0, 0, time.Local)
+
+// GlobalStates holds the UUIDs of the Miniserver global states.
+type GlobalStates struct {
+	OperatingMode  UUID
+	Sunrise        UUID
+	Sunset         UUID
+	Notifications  UUID
+	Modifications  UUID
+	MiniserverTime UUID
+	PastTasks      UUID
+	PlannedTasks   UUID
+}
+
+// subscription forwards the updates of a global state to a typed channel until done is closed.
+type subscription struct {
+	values chan interface{}
+	done   chan struct{}
+}
+
+// OperatingModes maps operating mode ids to their names.
+type OperatingModes map[int]string
+
+// Notification is a push notification sent by the Miniserver.
+type Notification struct {
+	UID       string  `json:"uid"`
+	Type      int     `json:"type"`
+	Level     int     `json:"lvl"`
+	Title     string  `json:"title"`
+	Message   string  `json:"message"`
+	Timestamp float64 `json:"ts"`
+}
+
+// Task is a task planned on or executed by the Miniserver.
+type Task struct {
+	UUID UUID    `json:"uuid"`
+	Name string  `json:"name"`
+	Date float64 `json:"date"`
+}
+
+// OperatingModeEntry is a calendar entry activating an operating mode.
+type OperatingModeEntry struct {
+	UUID          UUID   `json:"uuid"`
+	Name          string `json:"name"`
+	OperatingMode int    `json:"operatingMode"`
+}
+
+// Clock follows the Miniserver time.
+type Clock struct {
+	socket    *WebSocket
+	ch        chan time.Time
+	mutex     *sync.RWMutex
+	reference time.Time
+	received  time.Time
+}
+
+// GlobalStates returns the global state UUIDs read from the structure file.
+func (socket *WebSocket) GlobalStates() GlobalStates {
+	return socket.globalStates
+}
+
+// OperatingModes returns the operating modes read from the structure file.
+func (socket *WebSocket) OperatingModes() OperatingModes {
+	return socket.operatingModes
+}
+
+// SubscribeOperatingMode returns a channel for receiving the current operating mode.
+func (socket *WebSocket) SubscribeOperatingMode() (ch chan int, err error) {
+	ch = make(chan int)
+	sub, err := socket.subscribeState("operating mode", socket.globalStates.OperatingMode, ch)
+	if err == nil {
+		go func() {
+			defer close(ch)
+			defer sub.drain()
+			for val := range sub.values {
+				if mode, ok := val.(float64); ok {
+					select {
+					case ch <- int(mode):
+					case <-sub.done:
+						return
+					}
+				}
+			}
+		}()
+	}
+	return ch, err
+}
+
+// SubscribeSunrise returns a channel for receiving the time of day of the sunrise.
+func (socket *WebSocket) SubscribeSunrise() (ch chan time.Duration, err error) {
+	return socket.subscribeTimeOfDay("sunrise", socket.globalStates.Sunrise)
+}
+
+// SubscribeSunset returns a channel for receiving the time of day of the sunset.
+func (socket *WebSocket) SubscribeSunset() (ch chan time.Duration, err error) {
+	return socket.subscribeTimeOfDay("sunset", socket.globalStates.Sunset)
+}
+
+// SubscribeNotifications returns a channel for receiving push notifications.
+func (socket *WebSocket) SubscribeNotifications() (ch chan Notification, err error) {
+	ch = make(chan Notification)
+	sub, err := socket.subscribeState("notifications", socket.globalStates.Notifications, ch)
+	if err == nil {
+		go func() {
+			defer close(ch)
+			defer sub.drain()
+			for val := range sub.values {
+				var n Notification
+				if text, ok := val.(string); ok && json.Unmarshal([]byte(text), &n) == nil {
+					select {
+					case ch <- n:
+					case <-sub.done:
+						return
+					}
+				}
+			}
+		}()
+	}
+	return ch, err
+}
+
+// SubscribeModifications returns a channel for receiving structure modification counters.
+func (socket *WebSocket) SubscribeModifications() (ch chan int, err error) {
+	ch = make(chan int)
+	sub, err := socket.subscribeState("modifications", socket.globalStates.Modifications, ch)
+	if err == nil {
+		go func() {
+			defer close(ch)
+			defer sub.drain()
+			for val := range sub.values {
+				if count, ok := val.(float64); ok {
+					select {
+					case ch <- int(count):
+					case <-sub.done:
+						return
+					}
+				}
+			}
+		}()
+	}
+	return ch, err
+}
+
+// SubscribeMiniserverTime returns a channel for receiving the Miniserver time.
+func (socket *WebSocket) SubscribeMiniserverTime() (ch chan time.Time, err error) {
+	ch = make(chan time.Time)
+	sub, err := socket.subscribeState("miniserver time", socket.globalStates.MiniserverTime, ch)
+	if err == nil {
+		go func() {
+			defer close(ch)
+			defer sub.drain()
+			for val := range sub.values {
+				if t, err := decodeMiniserverTime(val); err == nil {
+					select {
+					case ch <- t:
+					case <-sub.done:
+						return
+					}
+				}
+			}
+		}()
+	}
+	return ch, err
+}
+
+// SubscribePastTasks returns a channel for receiving the tasks executed by the Miniserver.
+func (socket *WebSocket) SubscribePastTasks() (ch chan []Task, err error) {
+	return socket.subscribeTasks("past tasks", socket.globalStates.PastTasks)
+}
+
+// SubscribePlannedTasks returns a channel for receiving the tasks planned on the Miniserver.
+func (socket *WebSocket) SubscribePlannedTasks() (ch chan []Task, err error) {
+	return socket.subscribeTasks("planned tasks", socket.globalStates.PlannedTasks)
+}
+
+// OperatingModeEntries returns the calendar entries activating operating modes.
+func (socket *WebSocket) OperatingModeEntries() (entries []OperatingModeEntry, err error) {
+	val, err := socket.call("jdev/sps/calendargetentries")
+	if err == nil {
+		err = decodeValue(val, &entries)
+	}
+	return entries, err
+}
+
+// SetOperatingMode switches the Miniserver to the given operating mode for the current day.
+//
+// The calendar entry created by the first call is updated by the following ones.
+func (socket *WebSocket) SetOperatingMode(mode int) (uuid UUID, err error) {
+	entries, err := socket.OperatingModeEntries()
+	if err != nil {
+		return uuid, err
+	}
+	today := time.Now()
+	for _, entry := range entries {
+		if entry.Name == operatingModeEntryName {
+			return entry.UUID, socket.UpdateOperatingModeEntry(entry.UUID, operatingModeEntryName, mode, today, today)
+		}
+	}
+	return socket.ScheduleOperatingMode(operatingModeEntryName, mode, today, today)
+}
+
+// ScheduleOperatingMode creates a calendar entry activating the given operating mode from `from` to `to`
+// and returns its uuid.
+func (socket *WebSocket) ScheduleOperatingMode(name string, mode int, from, to time.Time) (uuid UUID, err error) {
+	err = socket.checkOperatingMode(mode, from, to)
+	if err == nil {
+		var val interface{}
+		val, err = socket.call(fmt.Sprintf("jdev/sps/calendarcreateentry/%s", operatingModePeriod(name, mode, from, to)))
+		if text, ok := val.(string); err == nil && ok {
+			uuid = UUID(text)
+		} else if err == nil {
+			err = fmt.Errorf("invalid calendar entry uuid %v", val)
+		}
+	}
+	return uuid, err
+}
+
+// UpdateOperatingModeEntry changes the calendar entry with the given uuid.
+func (socket *WebSocket) UpdateOperatingModeEntry(uuid UUID, name string, mode int, from, to time.Time) (err error) {
+	if uuid == "" {
+		return fmt.Errorf("missing calendar entry uuid")
+	}
+	err = socket.checkOperatingMode(mode, from, to)
+	if err == nil {
+		_, err = socket.call(fmt.Sprintf("jdev/sps/calendarupdateentry/%s/%s", uuid, operatingModePeriod(name, mode, from, to)))
+	}
+	return err
+}
+
+// DeleteOperatingModeEntry deletes the calendar entry with the given uuid.
+func (socket *WebSocket) DeleteOperatingModeEntry(uuid UUID) (err error) {
+	if uuid == "" {
+		return fmt.Errorf("missing calendar entry uuid")
+	}
+	_, err = socket.call(fmt.Sprintf("jdev/sps/calendardeleteentry/%s", uuid))
+	return err
+}
+
+// Unsubscribe stops the updates sent on a channel returned by one of the Subscribe methods and closes it.
+func (socket *WebSocket) Unsubscribe(ch interface{}) {
+	socket.mutex.Lock()
+	sub, ok := socket.subscriptions[ch]
+	delete(socket.subscriptions, ch)
+	socket.mutex.Unlock()
+	if ok {
+		close(sub.done)
+		broker.Unsub(sub.values)
+	} else if values, ok := ch.(chan interface{}); ok {
+		broker.Unsub(values)
+	}
+}
+
+// Clock returns a clock following the Miniserver time until it is stopped.
+func (socket *WebSocket) Clock() (clock *Clock, err error) {
+	ch, err := socket.SubscribeMiniserverTime()
+	if err == nil {
+		clock = &Clock{socket: socket, ch: ch, mutex: &sync.RWMutex{}}
+		go func() {
+			for t := range ch {
+				clock.mutex.Lock()
+				clock.reference = t
+				clock.received = time.Now()
+				clock.mutex.Unlock()
+			}
+		}()
+	}
+	return clock, err
+}
+
+// Stop stops following the Miniserver time, the clock then runs on the last time received.
+func (clock *Clock) Stop() {
+	clock.socket.Unsubscribe(clock.ch)
+}
+
+// Now returns the current Miniserver time.
+func (clock *Clock) Now() time.Time {
+	clock.mutex.RLock()
+	defer clock.mutex.RUnlock()
+	if clock.received.IsZero() {
+		return time.Now()
+	}
+	return clock.reference.Add(time.Since(clock.received))
+}
+
+// TimeOfDay returns the time elapsed since midnight on the Miniserver.
+func (clock *Clock) TimeOfDay() time.Duration {
+	now := clock.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return now.Sub(midnight)
+}
+
+// Time returns the time of the task.
+func (task Task) Time() time.Time {
+	return loxoneTime(task.Date)
+}
+
+func (socket *WebSocket) subscribeTimeOfDay(name string, uuid UUID) (ch chan time.Duration, err error) {
+	ch = make(chan time.Duration)
+	sub, err := socket.subscribeState(name, uuid, ch)
+	if err == nil {
+		go func() {
+			defer close(ch)
+			defer sub.drain()
+			for val := range sub.values {
+				if minutes, ok := val.(float64); ok {
+					select {
+					case ch <- time.Duration(minutes) * time.Minute:
+					case <-sub.done:
+						return
+					}
+				}
+			}
+		}()
+	}
+	return ch, err
+}
+
+func (socket *WebSocket) subscribeTasks(name string, uuid UUID) (ch chan []Task, err error) {
+	ch = make(chan []Task)
+	sub, err := socket.subscribeState(name, uuid, ch)
+	if err == nil {
+		go func() {
+			defer close(ch)
+			defer sub.drain()
+			for val := range sub.values {
+				var tasks []Task
+				if text, ok := val.(string); ok && json.Unmarshal([]byte(text), &tasks) == nil {
+					select {
+					case ch <- tasks:
+					case <-sub.done:
+						return
+					}
+				}
+			}
+		}()
+	}
+	return ch, err
+}
+
+// subscribeState subscribes to the given global state on behalf of the typed channel ch.
+func (socket *WebSocket) subscribeState(name string, uuid UUID, ch interface{}) (sub *subscription, err error) {
+	if uuid == "" {
+		return nil, fmt.Errorf("unknown %s global state, LoxAPP3 must be called first", name)
+	}
+	sub = &subscription{socket.Subscribe(uuid), make(chan struct{})}
+	socket.mutex.Lock()
+	socket.subscriptions[ch] = sub
+	socket.mutex.Unlock()
+	return sub, nil
+}
+
+// drain discards the updates left until the subscription is closed by Unsubscribe.
+func (sub *subscription) drain() {
+	for range sub.values {
+	}
+}
+
+func (socket *WebSocket) checkOperatingMode(mode int, from, to time.Time) (err error) {
+	if socket.operatingModes == nil {
+		err = fmt.Errorf("unknown operating modes, LoxAPP3 must be called first")
+	} else if _, ok := socket.operatingModes[mode]; !ok {
+		err = fmt.Errorf("unknown operating mode %d", mode)
+	} else if to.Before(from) {
+		err = fmt.Errorf("invalid operating mode period")
+	}
+	return err
+}
+
+func operatingModePeriod(name string, mode int, from, to time.Time) string {
+	return fmt.Sprintf("%s/%d/%d/%s/%s", url.PathEscape(name), mode, calendarPeriod, from.Format(calendarDateFormat), to.Format(calendarDateFormat))
+}
+
+func decodeGlobalStates(app3 map[string]interface{}) (states GlobalStates) {
+	if data, ok := app3["globalStates"].(map[string]interface{}); ok {
+		uuid := func(key string) UUID {
+			s, _ := data[key].(string)
+			return UUID(s)
+		}
+		states = GlobalStates{
+			OperatingMode:  uuid("operatingMode"),
+			Sunrise:        uuid("sunrise"),
+			Sunset:         uuid("sunset"),
+			Notifications:  uuid("notifications"),
+			Modifications:  uuid("modifications"),
+			MiniserverTime: uuid("miniserverTime"),
+			PastTasks:      uuid("pastTasks"),
+			PlannedTasks:   uuid("plannedTasks"),
+		}
+	}
+	return states
+}
+
+func decodeOperatingModes(app3 map[string]interface{}) (modes OperatingModes) {
+	if data, ok := app3["operatingModes"].(map[string]interface{}); ok {
+		modes = make(OperatingModes)
+		for k, v := range data {
+			if id, err := strconv.Atoi(k); err == nil {
+				modes[id] = fmt.Sprint(v)
+			}
+		}
+	}
+	return modes
+}
+
+func decodeMiniserverTime(val interface{}) (t time.Time, err error) {
+	switch v := val.(type) {
+	case float64:
+		t = loxoneTime(v)
+	case string:
+		t, err = time.Parse("2006-01-02 15:04:05 -07:00", v)
+		if err != nil {
+			t, err = time.ParseInLocation("2006-01-02 15:04:05", v, time.Local)
+		}
+	default:
+		err = fmt.Errorf("invalid miniserver time %v", val)
+	}
+	return t, err
+}
+
+func loxoneTime(secs float64) time.Time {
+	return loxoneEpoch.Add(time.Duration(secs * float64(time.Second)))
+}
@@ -0,0 +1,69 @@
+package loxone
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSubscribeGlobalState(t *testing.T) {
+	socket := &WebSocket{subscriptions: make(map[interface{}]*subscription), mutex: &sync.Mutex{}}
+	if _, err := socket.SubscribeOperatingMode(); err == nil {
+		t.Fatal("expected error for unknown global state")
+	}
+
+	socket.globalStates.OperatingMode = testUUIDString
+	ch, err := socket.SubscribeOperatingMode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker.Pub(float64(3), string(testUUIDString))
+	select {
+	case mode := <-ch:
+		if mode != 3 {
+			t.Errorf("operating mode = %d, want 3", mode)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for operating mode")
+	}
+
+	// updates nobody reads must not block unsubscribing
+	broker.Pub(float64(4), string(testUUIDString))
+	broker.Pub(float64(5), string(testUUIDString))
+	socket.Unsubscribe(ch)
+	select {
+	case _, ok := <-ch:
+		for ok {
+			_, ok = <-ch
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after unsubscribe")
+	}
+	if len(socket.subscriptions) != 0 {
+		t.Errorf("%d subscriptions left", len(socket.subscriptions))
+	}
+}
+
+func TestScheduleOperatingMode(t *testing.T) {
+	ms, socket := newTestMiniserver(t, func(cmd string) (int, interface{}) {
+		return 200, string(testUUIDString)
+	})
+	socket.operatingModes = OperatingModes{3: "Holiday"}
+	from := time.Date(2018, 12, 24, 0, 0, 0, 0, time.Local)
+	to := time.Date(2019, 1, 6, 0, 0, 0, 0, time.Local)
+	if _, err := socket.ScheduleOperatingMode("Winter holidays", 3, to, from); err == nil {
+		t.Error("expected error for inverted period")
+	}
+	uuid, err := socket.ScheduleOperatingMode("Winter holidays", 3, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uuid != testUUIDString {
+		t.Errorf("uuid = %s, want %s", uuid, testUUIDString)
+	}
+	want := []string{"jdev/sps/calendarcreateentry/Winter%20holidays/3/4/2018-12-24/2019-01-06"}
+	if cmds := ms.Commands(); !reflect.DeepEqual(cmds, want) {
+		t.Errorf("commands = %q, want %q", cmds, want)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
@@ -15,6 +16,8 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -35,8 +38,18 @@ type payload struct {
 }
 
 type WebSocket struct {
-	conn  *websocket.Conn
-	queue chan payload
+	conn           *websocket.Conn
+	queue          chan payload
+	host           string
+	username       string
+	token          token
+	globalStates   GlobalStates
+	operatingModes OperatingModes
+	decoder        *decoder
+	buf            bytes.Buffer
+	subscriptions  map[interface{}]*subscription
+	mutex          *sync.Mutex
+	callMutex      *sync.Mutex
 }
 
 type UUID string
@@ -61,6 +74,27 @@ type WeatherEvent struct {
 	entries    []WeatherEntry
 }
 
+// token is the session token acquired by AcquireToken.
+type token struct {
+	Token       string     `json:"token"`
+	ValidUntil  float64    `json:"validUntil"`
+	TokenRights Permission `json:"tokenRights"`
+}
+
+// userSalt is the key and salt used to hash the user credentials.
+type userSalt struct {
+	Key     string `json:"key"`
+	Salt    string `json:"salt"`
+	HashAlg string `json:"hashAlg"`
+}
+
+const (
+	// tokenPermission requests a long lived app token.
+	tokenPermission = 4
+	clientUUID      = "c0c4b9a0-7a5e-4d3b-ffff636f75636870"
+	clientInfo      = "couchpotatoe"
+)
+
 var broker = pubsub.New(1)
 
 // Connect connects the WebSocket to the Miniserver.
@@ -69,7 +103,7 @@ func Connect(host string) (socket *WebSocket, err error) {
 	protoHeaders := http.Header{"Sec-WebSocket-Protocol": {"remotecontrol"}}
 	conn, _, err := websocket.DefaultDialer.Dial(websocketURL.String(), protoHeaders)
 	if err == nil {
-		socket = &WebSocket{conn, make(chan payload)}
+		socket = &WebSocket{conn: conn, queue: make(chan payload), host: host, decoder: newDecoder(), subscriptions: make(map[interface{}]*subscription), mutex: &sync.Mutex{}, callMutex: &sync.Mutex{}}
 		go socket.processIncomingMessages()
 	}
 	return socket, err
@@ -86,16 +120,75 @@ func (socket *WebSocket) Authenticate(username, password string) (err error) {
 			comp.Write(cred)
 			hash := hex.EncodeToString(comp.Sum(nil))
 			_, err = socket.call(fmt.Sprintf("authenticate/%s", hash))
+			if err == nil {
+				socket.username = username
+			}
+		}
+	}
+	return err
+}
+
+// AcquireToken acquires a session token for the given credentials.
+//
+// The token is required for requesting camera images from the Miniserver and for reading the user permissions.
+// It must be renewed with RefreshToken before it expires.
+func (socket *WebSocket) AcquireToken(username, password string) (err error) {
+	val, err := socket.call(fmt.Sprintf("jdev/sys/getkey2/%s", url.PathEscape(username)))
+	if err == nil {
+		var salt userSalt
+		err = decodeValue(val, &salt)
+		if err == nil {
+			var hash string
+			hash, err = salt.hash(username, password)
+			if err == nil {
+				val, err = socket.call(fmt.Sprintf("jdev/sys/gettoken/%s/%s/%d/%s/%s", hash, url.PathEscape(username), tokenPermission, clientUUID, clientInfo))
+			}
+		}
+	}
+	if err == nil {
+		var t token
+		err = decodeValue(val, &t)
+		if err == nil {
+			socket.username, socket.token = username, t
+		}
+	}
+	return err
+}
+
+// RefreshToken extends the validity of the session token acquired by AcquireToken.
+func (socket *WebSocket) RefreshToken() (err error) {
+	hash, err := socket.tokenHash()
+	if err == nil {
+		var val interface{}
+		val, err = socket.call(fmt.Sprintf("jdev/sys/refreshtoken/%s/%s", hash, url.PathEscape(socket.username)))
+		if err == nil {
+			var t token
+			err = decodeValue(val, &t)
+			if err == nil {
+				socket.token.ValidUntil = t.ValidUntil
+			}
 		}
 	}
 	return err
 }
 
+// TokenExpiry returns the time until which the session token is valid.
+func (socket *WebSocket) TokenExpiry() time.Time {
+	if socket.token.Token == "" {
+		return time.Time{}
+	}
+	return loxoneTime(socket.token.ValidUntil)
+}
+
 // LoxAPP3 returns the Miniserver structure file.
+//
+// The global states and operating modes it defines are kept for the typed subscriptions.
 func (socket *WebSocket) LoxAPP3() (app3 map[string]interface{}, err error) {
 	data, err := socket.call("data/LoxApp3.json")
 	if err == nil {
 		json.Unmarshal(data.([]byte), &app3)
+		socket.globalStates = decodeGlobalStates(app3)
+		socket.operatingModes = decodeOperatingModes(app3)
 	}
 	return app3, err
 }
@@ -121,7 +214,36 @@ func (socket *WebSocket) Close() error {
 	return socket.conn.Close()
 }
 
+// authQuery returns the query authenticating an HTTP request to the Miniserver with the session token.
+func (socket *WebSocket) authQuery() (query url.Values, err error) {
+	hash, err := socket.tokenHash()
+	if err == nil {
+		query = url.Values{"autht": {hash}, "user": {socket.username}}
+	}
+	return query, err
+}
+
+// tokenHash hashes the session token with a one-time key.
+func (socket *WebSocket) tokenHash() (hash string, err error) {
+	if socket.token.Token == "" {
+		return "", fmt.Errorf("not authenticated, AcquireToken must be called first")
+	}
+	val, err := socket.call("jdev/sys/getkey")
+	if err == nil {
+		var key []byte
+		key, err = hex.DecodeString(fmt.Sprint(val))
+		if err == nil {
+			comp := hmac.New(sha1.New, key)
+			comp.Write([]byte(socket.token.Token))
+			hash = hex.EncodeToString(comp.Sum(nil))
+		}
+	}
+	return hash, err
+}
+
 func (socket *WebSocket) call(cmd string) (val interface{}, err error) {
+	socket.callMutex.Lock()
+	defer socket.callMutex.Unlock()
 	err = socket.conn.WriteMessage(websocket.TextMessage, []byte(cmd))
 	if err == nil {
 		p := <-socket.queue
@@ -152,27 +274,27 @@ func (socket *WebSocket) processIncomingMessages() {
 			}
 			socket.queue <- payload{cmd, err, val}
 		case binaryFile:
-			socket.queue <- payload{"", nil, msgData}
+			socket.queue <- payload{"", nil, append([]byte(nil), msgData...)}
 		case valueEvent:
-			if t, err := decodeValueEventTable(msgData); err == nil {
+			if t, err := socket.decoder.decodeValueEventTable(msgData); err == nil {
 				socket.publishEventTable(t, msgType)
 			} else {
 				log.Println(err)
 			}
 		case textEvent:
-			if t, err := decodeTextEventTable(msgData); err == nil {
+			if t, err := socket.decoder.decodeTextEventTable(msgData); err == nil {
 				socket.publishEventTable(t, msgType)
 			} else {
 				log.Println(err)
 			}
 		case daytimerEvent:
-			if t, err := decodeDaytimerEventTable(msgData); err == nil {
+			if t, err := socket.decoder.decodeDaytimerEventTable(msgData); err == nil {
 				socket.publishEventTable(t, msgType)
 			} else {
 				log.Println(err)
 			}
 		case weatherEvent:
-			if t, err := decodeWeatherEventTable(msgData); err == nil {
+			if t, err := socket.decoder.decodeWeatherEventTable(msgData); err == nil {
 				socket.publishEventTable(t, msgType)
 			} else {
 				log.Println(err)
@@ -189,8 +311,9 @@ func (socket *WebSocket) publishEventTable(events map[UUID]interface{}, eventTyp
 	}
 }
 
+// readMessage reads the next message. The returned data is only valid until the next call.
 func (socket *WebSocket) readMessage() (msgType uint8, msgData []byte, err error) {
-	sockMsgType, header, err := socket.conn.ReadMessage()
+	sockMsgType, header, err := socket.readFrame()
 	if err == nil {
 		if sockMsgType != websocket.BinaryMessage {
 			err = fmt.Errorf("invalid message type")
@@ -198,11 +321,11 @@ func (socket *WebSocket) readMessage() (msgType uint8, msgData []byte, err error
 			var msgSize uint32
 			msgType, msgSize, err = decodeMsgHeader(header)
 			if err == nil {
-				sockMsgType, msgData, err = socket.conn.ReadMessage()
+				sockMsgType, msgData, err = socket.readFrame()
 				if isBinaryTextMessage(msgType, msgData) {
 					header = msgData
 					_, msgSize, err = decodeMsgHeader(header)
-					_, msgData, err = socket.conn.ReadMessage()
+					_, msgData, err = socket.readFrame()
 				}
 				if err == nil {
 					if len(msgData) != int(msgSize) {
@@ -217,6 +340,33 @@ func (socket *WebSocket) readMessage() (msgType uint8, msgData []byte, err error
 	return msgType, msgData, err
 }
 
+func (socket *WebSocket) readFrame() (sockMsgType int, data []byte, err error) {
+	sockMsgType, r, err := socket.conn.NextReader()
+	if err == nil {
+		socket.buf.Reset()
+		_, err = socket.buf.ReadFrom(r)
+		data = socket.buf.Bytes()
+	}
+	return sockMsgType, data, err
+}
+
+// hash hashes the credentials with the salt and key returned by getkey2.
+func (salt userSalt) hash(username, password string) (hash string, err error) {
+	key, err := hex.DecodeString(salt.Key)
+	if err == nil {
+		newHash := sha1.New
+		if salt.HashAlg == "SHA256" {
+			newHash = sha256.New
+		}
+		pw := newHash()
+		pw.Write([]byte(fmt.Sprintf("%s:%s", password, salt.Salt)))
+		comp := hmac.New(newHash, key)
+		comp.Write([]byte(fmt.Sprintf("%s:%s", username, strings.ToUpper(hex.EncodeToString(pw.Sum(nil))))))
+		hash = hex.EncodeToString(comp.Sum(nil))
+	}
+	return hash, err
+}
+
 func isBinaryTextMessage(msgType uint8, data []byte) bool {
 	return msgType == binaryFile && len(data) == 8 && data[0] == 0x03
 }
@@ -252,191 +402,17 @@ func decodeMsgText(msg []byte) (cmd string, val interface{}, err error) {
 	return cmd, val, err
 }
 
-func decodeUUID(msg []byte) (uuid UUID, err error) {
-	if len(msg) != 16 {
-		err = fmt.Errorf("invalid uuid length")
-	} else {
-		var data1 uint32
-		var data2, data3 uint16
-		var data4 [8]byte
-		if err = binary.Read(bytes.NewReader(msg[0:4]), binary.LittleEndian, &data1); err == nil {
-			if err = binary.Read(bytes.NewReader(msg[4:6]), binary.LittleEndian, &data2); err == nil {
-				if err = binary.Read(bytes.NewReader(msg[6:8]), binary.LittleEndian, &data3); err == nil {
-					if err = binary.Read(bytes.NewReader(msg[8:16]), binary.LittleEndian, &data4); err == nil {
-						uuid = UUID(fmt.Sprintf("%08x-%04x-%04x-%02x%02x%02x%02x%02x%02x%02x%02x", data1, data2, data3, data4[0], data4[1], data4[2], data4[3], data4[4], data4[5], data4[6], data4[7]))
-					}
-				}
-			}
-		}
-	}
-	return uuid, err
-}
-
-func decodeValueEvent(msg []byte) (uuid UUID, val float64, err error) {
-	if len(msg) != 24 {
-		err = fmt.Errorf("invalid value event length")
-	} else {
-		uuid, err = decodeUUID(msg[:16])
-		if err == nil {
-			err = binary.Read(bytes.NewReader(msg[16:24]), binary.LittleEndian, &val)
-		}
-	}
-	return uuid, val, err
-}
-
-func decodeValueEventTable(msg []byte) (table map[UUID]interface{}, err error) {
-	table = make(map[UUID]interface{})
-	for i := 0; i < len(msg); i += 24 {
-		uuid, val, err := decodeValueEvent(msg[i : i+24])
-		if err != nil {
-			return table, err
+func decodeValue(val interface{}, v interface{}) (err error) {
+	data, ok := val.([]byte)
+	if !ok {
+		if text, isText := val.(string); isText {
+			data = []byte(text)
+		} else {
+			data, err = json.Marshal(val)
 		}
-		table[uuid] = val
 	}
-	return table, err
-}
-
-func decodeTextEvent(msg []byte) (uuid, uuidIcon UUID, text string, err error) {
-	uuid, err = decodeUUID(msg[:16])
 	if err == nil {
-		uuidIcon, err = decodeUUID(msg[16:32])
-		if err == nil {
-			textLength := binary.LittleEndian.Uint32(msg[32:36])
-			if int(textLength) > len(msg)-36 {
-				text = string(msg)
-				err = fmt.Errorf("invalid text event with length %d", textLength)
-			} else {
-				text = string(msg[36 : 36+textLength])
-			}
-		}
-	}
-	return uuid, uuidIcon, text, err
-}
-
-func decodeTextEventTable(msg []byte) (table map[UUID]interface{}, err error) {
-	table = make(map[UUID]interface{})
-	for i := 0; i < len(msg); {
-		uuid, _, text, err := decodeTextEvent(msg[i:])
-		if err != nil {
-			return table, err
-		}
-		table[uuid] = text
-		textLength := len(text)
-		i += textLength + textLength%4 + 36
-	}
-	return table, err
-}
-
-func decodeDaytimerEntry(msg []byte) (entry DayTimerEntry, err error) {
-	if len(msg) != 24 {
-		err = fmt.Errorf("invalid daytimer entry length")
-	} else {
-		if err = binary.Read(bytes.NewReader(msg[0:4]), binary.LittleEndian, &entry.mode); err == nil {
-			if err = binary.Read(bytes.NewReader(msg[4:8]), binary.LittleEndian, &entry.from); err == nil {
-				if err = binary.Read(bytes.NewReader(msg[8:12]), binary.LittleEndian, &entry.to); err == nil {
-					if err = binary.Read(bytes.NewReader(msg[12:16]), binary.LittleEndian, &entry.needActivate); err == nil {
-						err = binary.Read(bytes.NewReader(msg[16:24]), binary.LittleEndian, &entry.val)
-					}
-				}
-			}
-		}
-	}
-	return entry, err
-}
-
-func decodeDaytimerEventTable(msg []byte) (table map[UUID]interface{}, err error) {
-	table = make(map[UUID]interface{})
-	for i := 0; i < len(msg); {
-		uuid, err := decodeUUID(msg[i : i+16])
-		if err != nil {
-			return table, err
-		}
-		var defaultVal float64
-		if err = binary.Read(bytes.NewReader(msg[i+16:i+24]), binary.LittleEndian, &defaultVal); err != nil {
-			return table, err
-		}
-		var nrEntries int32
-		if err = binary.Read(bytes.NewReader(msg[i+24:i+28]), binary.LittleEndian, &nrEntries); err != nil {
-			return table, err
-		}
-		entries := make([]DayTimerEntry, nrEntries)
-		i += 28
-		max := i + int(nrEntries)*24
-		for i < max {
-			entry, err := decodeDaytimerEntry(msg[i : i+24])
-			if err != nil {
-				return table, err
-			}
-			entries = append(entries, entry)
-			i += 24
-		}
-		if err != nil {
-			return table, err
-		}
-		table[uuid] = DayTimerEvent{defaultVal, entries}
+		err = json.Unmarshal(data, v)
 	}
-	return table, err
-}
-
-func decodeWeatherEntry(msg []byte) (entry WeatherEntry, err error) {
-	if len(msg) != 68 {
-		err = fmt.Errorf("invalid weather entry length")
-	} else {
-		if err = binary.Read(bytes.NewReader(msg[:4]), binary.LittleEndian, &entry.timestamp); err == nil {
-			if err = binary.Read(bytes.NewReader(msg[4:8]), binary.LittleEndian, &entry.weatherType); err == nil {
-				if err = binary.Read(bytes.NewReader(msg[8:12]), binary.LittleEndian, &entry.windDirection); err == nil {
-					if err = binary.Read(bytes.NewReader(msg[12:16]), binary.LittleEndian, &entry.solarRadiation); err == nil {
-						if err = binary.Read(bytes.NewReader(msg[16:20]), binary.LittleEndian, &entry.relativeHumidity); err == nil {
-							if err = binary.Read(bytes.NewReader(msg[20:28]), binary.LittleEndian, &entry.temperature); err == nil {
-								if err = binary.Read(bytes.NewReader(msg[28:36]), binary.LittleEndian, &entry.perceivedTemperature); err == nil {
-									if err = binary.Read(bytes.NewReader(msg[36:44]), binary.LittleEndian, &entry.dewPoint); err == nil {
-										if err = binary.Read(bytes.NewReader(msg[44:52]), binary.LittleEndian, &entry.pricipitation); err == nil {
-											if err = binary.Read(bytes.NewReader(msg[52:60]), binary.LittleEndian, &entry.windSpeed); err == nil {
-												err = binary.Read(bytes.NewReader(msg[60:68]), binary.LittleEndian, &entry.barometicPressure)
-											}
-										}
-									}
-								}
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-	return entry, err
-}
-
-func decodeWeatherEventTable(msg []byte) (table map[UUID]interface{}, err error) {
-	table = make(map[UUID]interface{})
-	for i := 0; i < len(msg); {
-		uuid, err := decodeUUID(msg[i : i+16])
-		if err != nil {
-			return table, err
-		}
-		var lastUpdate uint32
-		if err = binary.Read(bytes.NewReader(msg[i+16:i+20]), binary.LittleEndian, &lastUpdate); err != nil {
-			return table, err
-		}
-		var nrEntries int32
-		if err = binary.Read(bytes.NewReader(msg[i+20:i+24]), binary.LittleEndian, &nrEntries); err != nil {
-			return table, err
-		}
-		entries := make([]WeatherEntry, nrEntries)
-		i += 24
-		max := i + int(nrEntries)*68
-		for i < max {
-			entry, err := decodeWeatherEntry(msg[i : i+68])
-			if err != nil {
-				return table, err
-			}
-			entries = append(entries, entry)
-			i += 68
-		}
-		if err != nil {
-			return table, err
-		}
-		table[uuid] = WeatherEvent{lastUpdate, entries}
-	}
-	return table, err
+	return err
 }
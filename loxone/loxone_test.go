@@ -0,0 +1,168 @@
+package loxone
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// miniserver is a fake Miniserver answering the commands sent over the WebSocket.
+type miniserver struct {
+	*httptest.Server
+	handle   func(cmd string) (code int, val interface{})
+	mutex    sync.Mutex
+	commands []string
+}
+
+// newTestMiniserver starts a fake Miniserver and returns a WebSocket connected to it.
+//
+// Commands are answered with the status code and value returned by handle, []byte values are sent as files.
+func newTestMiniserver(t *testing.T, handle func(cmd string) (code int, val interface{})) (*miniserver, *WebSocket) {
+	ms := &miniserver{handle: handle}
+	upgrader := websocket.Upgrader{Subprotocols: []string{"remotecontrol"}}
+	ms.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = ms.reply(conn, string(msg)); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(ms.Close)
+	socket, err := Connect(strings.TrimPrefix(ms.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { socket.Close() })
+	return ms, socket
+}
+
+// Commands returns the commands received so far.
+func (ms *miniserver) Commands() []string {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	return append([]string(nil), ms.commands...)
+}
+
+func (ms *miniserver) reply(conn *websocket.Conn, cmd string) error {
+	ms.mutex.Lock()
+	ms.commands = append(ms.commands, cmd)
+	ms.mutex.Unlock()
+	code, val := ms.handle(cmd)
+	msgType, sockMsgType := byte(textMessage), websocket.TextMessage
+	data, ok := val.([]byte)
+	if ok {
+		msgType, sockMsgType = binaryFile, websocket.BinaryMessage
+	} else {
+		data, _ = json.Marshal(map[string]interface{}{
+			"LL": map[string]interface{}{"control": cmd, "Code": strconv.Itoa(code), "value": val},
+		})
+	}
+	header := []byte{0x03, msgType, 0, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(data)))
+	err := conn.WriteMessage(websocket.BinaryMessage, header)
+	if err == nil {
+		err = conn.WriteMessage(sockMsgType, data)
+	}
+	return err
+}
+
+func TestAuthenticate(t *testing.T) {
+	ms, socket := newTestMiniserver(t, func(cmd string) (int, interface{}) {
+		return 200, "41434633"
+	})
+	if err := socket.Authenticate("admin", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"jdev/sys/getkey", "authenticate/" + testHMAC(sha1.New, "ACF3", "admin:secret")}
+	if cmds := ms.Commands(); !reflect.DeepEqual(cmds, want) {
+		t.Errorf("commands = %q, want %q", cmds, want)
+	}
+	if socket.username != "admin" {
+		t.Errorf("username = %q, want admin", socket.username)
+	}
+	if _, err := socket.Permissions(); err == nil {
+		t.Error("expected error without session token")
+	}
+}
+
+func TestAcquireToken(t *testing.T) {
+	var validUntil float64 = 342000000
+	ms, socket := newTestMiniserver(t, func(cmd string) (int, interface{}) {
+		switch {
+		case strings.HasPrefix(cmd, "jdev/sys/getkey2/"):
+			return 200, map[string]interface{}{"key": "41434633", "salt": "5a17", "hashAlg": "SHA256"}
+		case strings.HasPrefix(cmd, "jdev/sys/gettoken/"):
+			return 200, map[string]interface{}{"token": "8E2AA590", "validUntil": validUntil, "tokenRights": 0x1e}
+		case cmd == "jdev/sys/getkey":
+			return 200, "31323334"
+		case strings.HasPrefix(cmd, "jdev/sys/refreshtoken/"):
+			validUntil += 3600
+			return 200, map[string]interface{}{"validUntil": validUntil}
+		}
+		return 400, nil
+	})
+	if err := socket.RefreshToken(); err == nil {
+		t.Error("expected error for refreshing without token")
+	}
+	if err := socket.AcquireToken("admin", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	pwHash := sha256.Sum256([]byte("secret:5a17"))
+	credHash := testHMAC(sha256.New, "ACF3", "admin:"+strings.ToUpper(hex.EncodeToString(pwHash[:])))
+	want := []string{
+		"jdev/sys/getkey2/admin",
+		"jdev/sys/gettoken/" + credHash + "/admin/4/" + clientUUID + "/" + clientInfo,
+	}
+	if cmds := ms.Commands(); !reflect.DeepEqual(cmds, want) {
+		t.Errorf("commands = %q, want %q", cmds, want)
+	}
+	if perm, err := socket.Permissions(); err != nil || perm != 0x1e {
+		t.Errorf("permissions = %#x, %v, want 0x1e", perm, err)
+	}
+	expiry := socket.TokenExpiry()
+	if !expiry.Equal(loxoneTime(342000000)) {
+		t.Errorf("token expiry = %s, want %s", expiry, loxoneTime(342000000))
+	}
+
+	if err := socket.RefreshToken(); err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, "jdev/sys/getkey", "jdev/sys/refreshtoken/"+testHMAC(sha1.New, "1234", "8E2AA590")+"/admin")
+	if cmds := ms.Commands(); !reflect.DeepEqual(cmds, want) {
+		t.Errorf("commands = %q, want %q", cmds, want)
+	}
+	if d := socket.TokenExpiry().Sub(expiry); d != time.Hour {
+		t.Errorf("token extended by %s, want 1h", d)
+	}
+	if socket.token.Token != "8E2AA590" || socket.token.TokenRights != 0x1e {
+		t.Errorf("token = %+v, want the acquired token", socket.token)
+	}
+}
+
+func testHMAC(h func() hash.Hash, key, msg string) string {
+	comp := hmac.New(h, []byte(key))
+	comp.Write([]byte(msg))
+	return hex.EncodeToString(comp.Sum(nil))
+}
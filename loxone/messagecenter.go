@@ -0,0 +1,237 @@
+package loxone
+
+import (
+	"fmt"
+	"github.com/cskr/pubsub"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const messageCenterTopic = "messages"
+
+// Severity is the severity of a message center entry.
+type Severity int
+
+const (
+	SeverityInfo        Severity = 1
+	SeverityWarning     Severity = 2
+	SeverityError       Severity = 3
+	SeveritySystemError Severity = 4
+)
+
+// Message is an entry of the Miniserver message center.
+type Message struct {
+	ID           string    `json:"id"`
+	Severity     Severity  `json:"severity"`
+	Title        string    `json:"title"`
+	Text         string    `json:"text"`
+	Timestamp    time.Time `json:"timestamp"`
+	Acknowledged bool      `json:"acknowledged"`
+	system       bool
+}
+
+// MessageCenter collects notifications and system status messages sent by the Miniserver.
+type MessageCenter struct {
+	socket        *WebSocket
+	mutex         *sync.RWMutex
+	messages      map[string]Message
+	notifications chan Notification
+	updates       *pubsub.PubSub
+	subscriptions map[chan Message]*subscription
+	// pubMutex guards closed, which stops publishing once the updates are shut down.
+	pubMutex *sync.RWMutex
+	closed   bool
+}
+
+type messageCenterEntry struct {
+	EntryUUID   string    `json:"entryUuid"`
+	Title       string    `json:"title"`
+	Desc        string    `json:"desc"`
+	Severity    int       `json:"severity"`
+	Timestamps  []float64 `json:"timestamps"`
+	ConfirmedAt *float64  `json:"confirmedAt"`
+}
+
+// String returns the severity name.
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	case SeveritySystemError:
+		return "system error"
+	default:
+		return fmt.Sprintf("severity %d", int(s))
+	}
+}
+
+// MessageCenter returns a message center collecting push notifications from the socket.
+func (socket *WebSocket) MessageCenter() (mc *MessageCenter, err error) {
+	ch, err := socket.SubscribeNotifications()
+	if err != nil {
+		return nil, err
+	}
+	mc = &MessageCenter{
+		socket:        socket,
+		mutex:         &sync.RWMutex{},
+		messages:      make(map[string]Message),
+		notifications: ch,
+		updates:       pubsub.New(1),
+		subscriptions: make(map[chan Message]*subscription),
+		pubMutex:      &sync.RWMutex{},
+	}
+	go func() {
+		for n := range ch {
+			mc.add(Message{
+				ID:        n.UID,
+				Severity:  Severity(n.Level),
+				Title:     n.Title,
+				Text:      n.Message,
+				Timestamp: loxoneTime(n.Timestamp),
+			})
+		}
+	}()
+	return mc, nil
+}
+
+// Refresh fetches the system status messages from the Miniserver.
+func (mc *MessageCenter) Refresh() (err error) {
+	val, err := mc.socket.call("jdev/sps/getmessagecenter")
+	if err == nil {
+		var data struct {
+			Entries []messageCenterEntry `json:"entries"`
+		}
+		err = decodeValue(val, &data)
+		if err == nil {
+			for _, entry := range data.Entries {
+				msg := Message{
+					ID:           entry.EntryUUID,
+					Severity:     Severity(entry.Severity),
+					Title:        entry.Title,
+					Text:         entry.Desc,
+					Acknowledged: entry.ConfirmedAt != nil,
+					system:       true,
+				}
+				if n := len(entry.Timestamps); n > 0 {
+					msg.Timestamp = loxoneTime(entry.Timestamps[n-1])
+				}
+				mc.add(msg)
+			}
+		}
+	}
+	return err
+}
+
+// Messages returns the collected messages ordered by timestamp.
+func (mc *MessageCenter) Messages() (messages []Message) {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
+	for _, msg := range mc.messages {
+		messages = append(messages, msg)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].Timestamp.Before(messages[j].Timestamp)
+	})
+	return messages
+}
+
+// Subscribe returns a channel for receiving new and updated messages.
+func (mc *MessageCenter) Subscribe() chan Message {
+	ch := make(chan Message)
+	mc.pubMutex.RLock()
+	defer mc.pubMutex.RUnlock()
+	if mc.closed {
+		close(ch)
+		return ch
+	}
+	sub := &subscription{mc.updates.Sub(messageCenterTopic), make(chan struct{})}
+	mc.mutex.Lock()
+	mc.subscriptions[ch] = sub
+	mc.mutex.Unlock()
+	go func() {
+		defer close(ch)
+		defer sub.drain()
+		for val := range sub.values {
+			select {
+			case ch <- val.(Message):
+			case <-sub.done:
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// Unsubscribe stops the updates sent on a channel returned by Subscribe and closes it.
+func (mc *MessageCenter) Unsubscribe(ch chan Message) {
+	mc.mutex.Lock()
+	sub, ok := mc.subscriptions[ch]
+	delete(mc.subscriptions, ch)
+	mc.mutex.Unlock()
+	if ok {
+		close(sub.done)
+		mc.updates.Unsub(sub.values)
+	}
+}
+
+// Close stops collecting push notifications and closes all subscriptions.
+func (mc *MessageCenter) Close() {
+	mc.socket.Unsubscribe(mc.notifications)
+	mc.mutex.RLock()
+	var subscribed []chan Message
+	for ch := range mc.subscriptions {
+		subscribed = append(subscribed, ch)
+	}
+	mc.mutex.RUnlock()
+	for _, ch := range subscribed {
+		mc.Unsubscribe(ch)
+	}
+
+	mc.pubMutex.Lock()
+	defer mc.pubMutex.Unlock()
+	if !mc.closed {
+		mc.closed = true
+		mc.updates.Shutdown()
+	}
+}
+
+// Acknowledge acknowledges the message with the given id.
+func (mc *MessageCenter) Acknowledge(id string) (err error) {
+	mc.mutex.RLock()
+	msg, ok := mc.messages[id]
+	mc.mutex.RUnlock()
+	if !ok {
+		err = fmt.Errorf("unknown message %s", id)
+	} else if !msg.Acknowledged {
+		if msg.system {
+			_, err = mc.socket.call(fmt.Sprintf("jdev/sps/confirmmessage/%s", id))
+		}
+		if err == nil {
+			msg.Acknowledged = true
+			mc.add(msg)
+		}
+	}
+	return err
+}
+
+func (mc *MessageCenter) add(msg Message) {
+	if strings.TrimSpace(msg.ID) == "" {
+		msg.ID = fmt.Sprintf("%d", msg.Timestamp.UnixNano())
+	}
+	mc.mutex.Lock()
+	old, ok := mc.messages[msg.ID]
+	mc.messages[msg.ID] = msg
+	mc.mutex.Unlock()
+	if !ok || old != msg {
+		mc.pubMutex.RLock()
+		if !mc.closed {
+			mc.updates.Pub(msg, messageCenterTopic)
+		}
+		mc.pubMutex.RUnlock()
+	}
+}
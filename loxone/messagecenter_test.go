@@ -0,0 +1,48 @@
+package loxone
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMessageCenter(t *testing.T) {
+	socket := &WebSocket{subscriptions: make(map[interface{}]*subscription), mutex: &sync.Mutex{}}
+	socket.globalStates.Notifications = UUID("notifications")
+	mc, err := socket.MessageCenter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mc.Close()
+	other, err := socket.MessageCenter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := other.Subscribe()
+
+	// a burst of notifications must not block the broker on the message center itself
+	for i := 0; i < 10; i++ {
+		broker.Pub(fmt.Sprintf(`{"uid":"%d","lvl":2,"title":"Alarm","ts":%d}`, i, i), string(socket.globalStates.Notifications))
+		select {
+		case msg := <-ch:
+			if msg.ID != fmt.Sprint(i) || msg.Severity != SeverityWarning {
+				t.Errorf("message = %+v", msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for message %d", i)
+		}
+	}
+	other.Close()
+	if _, ok := <-ch; ok {
+		t.Error("subscription not closed")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(mc.Messages()) < 10 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if messages := mc.Messages(); len(messages) != 10 || messages[0].ID != "0" {
+		t.Errorf("messages = %+v", messages)
+	}
+}
@@ -0,0 +1,182 @@
+package loxone
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Permission is a bitmask of user rights, as granted to the session token.
+type Permission uint32
+
+const (
+	PermissionNone            Permission = 0x0
+	PermissionWeb             Permission = 0x1
+	PermissionLoxoneConfig    Permission = 0x4
+	PermissionFTP             Permission = 0x8
+	PermissionTelnet          Permission = 0x10
+	PermissionOperatingModes  Permission = 0x20
+	PermissionAutopilot       Permission = 0x40
+	PermissionExpertModeLight Permission = 0x80
+	PermissionUserManagement  Permission = 0x100
+	PermissionAdmin           Permission = 0xFFFFFFFF
+)
+
+// User is a Miniserver user.
+type User struct {
+	UUID      UUID   `json:"uuid,omitempty"`
+	Name      string `json:"name"`
+	IsAdmin   bool   `json:"isAdmin"`
+	UserState int    `json:"userState"`
+}
+
+// UserGroup is a group of Miniserver users sharing the same rights.
+type UserGroup struct {
+	UUID       UUID       `json:"uuid"`
+	Name       string     `json:"name"`
+	UserRights Permission `json:"userRights"`
+}
+
+// UserDetails is a Miniserver user with its group memberships.
+type UserDetails struct {
+	User
+	UserGroups []UserGroup `json:"usergroups"`
+}
+
+// Has reports whether all the given permissions are set.
+func (p Permission) Has(q Permission) bool {
+	return p&q == q
+}
+
+// Permissions returns the rights of the session token acquired by AcquireToken.
+func (socket *WebSocket) Permissions() (perm Permission, err error) {
+	if socket.token.Token == "" {
+		err = fmt.Errorf("not authenticated, AcquireToken must be called first")
+	}
+	return socket.token.TokenRights, err
+}
+
+// Permissions returns the rights granted to the user by its groups.
+func (details UserDetails) Permissions() (perm Permission) {
+	if details.IsAdmin {
+		return PermissionAdmin
+	}
+	for _, group := range details.UserGroups {
+		perm |= group.UserRights
+	}
+	return perm
+}
+
+// Users returns the list of Miniserver users.
+func (socket *WebSocket) Users() (users []User, err error) {
+	val, err := socket.call("jdev/sps/getuserlist2")
+	if err == nil {
+		err = decodeValue(val, &users)
+	}
+	return users, err
+}
+
+// User returns the details of the user with the given uuid.
+func (socket *WebSocket) User(uuid UUID) (details UserDetails, err error) {
+	val, err := socket.call(fmt.Sprintf("jdev/sps/getuser/%s", uuid))
+	if err == nil {
+		err = decodeValue(val, &details)
+	}
+	return details, err
+}
+
+// CreateUser creates the given user and returns its uuid.
+func (socket *WebSocket) CreateUser(details UserDetails) (uuid UUID, err error) {
+	details.UUID = ""
+	return socket.addOrEditUser(details)
+}
+
+// UpdateUser updates the given user.
+func (socket *WebSocket) UpdateUser(details UserDetails) (err error) {
+	if details.UUID == "" {
+		err = fmt.Errorf("missing user uuid")
+	} else {
+		_, err = socket.addOrEditUser(details)
+	}
+	return err
+}
+
+// DeleteUser deletes the user with the given uuid.
+func (socket *WebSocket) DeleteUser(uuid UUID) (err error) {
+	_, err = socket.call(fmt.Sprintf("jdev/sps/deleteuser/%s", uuid))
+	return err
+}
+
+// SetPassword changes the password of the user with the given uuid.
+func (socket *WebSocket) SetPassword(uuid UUID, password string) (err error) {
+	salt := make([]byte, 16)
+	_, err = rand.Read(salt)
+	if err == nil {
+		saltHex := hex.EncodeToString(salt)
+		hash := sha1.Sum([]byte(fmt.Sprintf("%s:%s", password, saltHex)))
+		value := fmt.Sprintf("%s:%s", strings.ToUpper(hex.EncodeToString(hash[:])), saltHex)
+		_, err = socket.call(fmt.Sprintf("jdev/sps/updateuserpwdh/%s/%s", uuid, value))
+	}
+	return err
+}
+
+// CheckAccess returns an error for each of the given uuids the authenticated user cannot access.
+//
+// The structure file only lists the controls visible to the user it was fetched with, so uuids
+// missing from it are not accessible. Both control uuids (with an optional sub-control path) and
+// state uuids are accepted.
+func (socket *WebSocket) CheckAccess(app3 map[string]interface{}, uuids ...UUID) (errs []error) {
+	known := make(map[UUID]bool)
+	controls, _ := app3["controls"].(map[string]interface{})
+	collectControlUUIDs(controls, known)
+	for _, uuid := range uuids {
+		if !known[UUID(strings.SplitN(string(uuid), "/", 2)[0])] {
+			errs = append(errs, fmt.Errorf("no access to %s for user %s", uuid, socket.username))
+		}
+	}
+	return errs
+}
+
+func (socket *WebSocket) addOrEditUser(details UserDetails) (uuid UUID, err error) {
+	data, err := json.Marshal(details)
+	if err == nil {
+		var val interface{}
+		val, err = socket.call(fmt.Sprintf("jdev/sps/addoredituser/%s", url.PathEscape(string(data))))
+		if err == nil {
+			var user User
+			if decodeValue(val, &user) == nil && user.UUID != "" {
+				uuid = user.UUID
+			} else {
+				uuid = details.UUID
+			}
+		}
+	}
+	return uuid, err
+}
+
+func collectControlUUIDs(controls map[string]interface{}, known map[UUID]bool) {
+	for k, v := range controls {
+		known[UUID(k)] = true
+		control, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if action, ok := control["uuidAction"].(string); ok {
+			known[UUID(action)] = true
+		}
+		if states, ok := control["states"].(map[string]interface{}); ok {
+			for _, state := range states {
+				if s, ok := state.(string); ok {
+					known[UUID(s)] = true
+				}
+			}
+		}
+		if subControls, ok := control["subControls"].(map[string]interface{}); ok {
+			collectControlUUIDs(subControls, known)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package loxone
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPermissions(t *testing.T) {
+	socket := &WebSocket{}
+	if _, err := socket.Permissions(); err == nil {
+		t.Error("expected error without session token")
+	}
+	if err := decodeValue(`{"token":"8E2AA590","validUntil":342000000,"tokenRights":289}`, &socket.token); err != nil {
+		t.Fatal(err)
+	}
+	perm, err := socket.Permissions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []Permission{PermissionWeb, PermissionOperatingModes, PermissionUserManagement, PermissionWeb | PermissionOperatingModes} {
+		if !perm.Has(p) {
+			t.Errorf("%#x does not have %#x", perm, p)
+		}
+	}
+	for _, p := range []Permission{PermissionLoxoneConfig, PermissionTelnet, PermissionWeb | PermissionFTP, PermissionAdmin} {
+		if perm.Has(p) {
+			t.Errorf("%#x has %#x", perm, p)
+		}
+	}
+	if !PermissionAdmin.Has(PermissionLoxoneConfig | PermissionUserManagement) {
+		t.Error("admin permission misses rights")
+	}
+
+	details := UserDetails{UserGroups: []UserGroup{{UserRights: PermissionWeb}, {UserRights: PermissionAutopilot | PermissionFTP}}}
+	if perm := details.Permissions(); perm != PermissionWeb|PermissionAutopilot|PermissionFTP {
+		t.Errorf("group permissions = %#x", perm)
+	}
+	details.IsAdmin = true
+	if perm := details.Permissions(); perm != PermissionAdmin {
+		t.Errorf("admin permissions = %#x", perm)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	_, socket := newTestMiniserver(t, func(cmd string) (int, interface{}) {
+		return 200, `[{"name":"admin","uuid":"106e6773-02a9-e641-ffff20df2fc4e78a","isAdmin":true,"userState":0},{"name":"guest","uuid":"106e6773-02a9-e642-ffff20df2fc4e78a","isAdmin":false,"userState":2}]`
+	})
+	users, err := socket.Users()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []User{
+		{UUID: testUUIDString, Name: "admin", IsAdmin: true},
+		{UUID: "106e6773-02a9-e642-ffff20df2fc4e78a", Name: "guest", UserState: 2},
+	}
+	if !reflect.DeepEqual(users, want) {
+		t.Errorf("users = %+v, want %+v", users, want)
+	}
+}
+
+func TestEditUsers(t *testing.T) {
+	ms, socket := newTestMiniserver(t, func(cmd string) (int, interface{}) {
+		if strings.HasPrefix(cmd, "jdev/sps/addoredituser/") {
+			return 200, map[string]interface{}{"uuid": string(testUUIDString)}
+		}
+		return 200, nil
+	})
+	details := UserDetails{User: User{UUID: "106e6773-02a9-e642-ffff20df2fc4e78a", Name: "guest"}}
+	uuid, err := socket.CreateUser(details)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uuid != testUUIDString {
+		t.Errorf("uuid = %s, want %s", uuid, testUUIDString)
+	}
+	if err = socket.UpdateUser(UserDetails{User: User{Name: "guest"}}); err == nil {
+		t.Error("expected error for missing uuid")
+	}
+	details.UUID = testUUIDString
+	if err = socket.UpdateUser(details); err != nil {
+		t.Fatal(err)
+	}
+	if err = socket.DeleteUser(testUUIDString); err != nil {
+		t.Fatal(err)
+	}
+
+	cmds := ms.Commands()
+	if len(cmds) != 3 {
+		t.Fatalf("commands = %q, want 3 commands", cmds)
+	}
+	for i, wantUUID := range []UUID{"", testUUIDString} {
+		var edited UserDetails
+		data, err := url.PathUnescape(strings.TrimPrefix(cmds[i], "jdev/sps/addoredituser/"))
+		if err == nil {
+			err = json.Unmarshal([]byte(data), &edited)
+		}
+		if err != nil {
+			t.Errorf("invalid command %q: %v", cmds[i], err)
+		} else if edited.UUID != wantUUID || edited.Name != "guest" {
+			t.Errorf("edited user = %+v, want uuid %q", edited, wantUUID)
+		}
+	}
+	if want := "jdev/sps/deleteuser/" + string(testUUIDString); cmds[2] != want {
+		t.Errorf("command = %q, want %q", cmds[2], want)
+	}
+}
+
+func TestSetPassword(t *testing.T) {
+	ms, socket := newTestMiniserver(t, func(cmd string) (int, interface{}) {
+		return 200, nil
+	})
+	if err := socket.SetPassword(testUUIDString, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	cmds := ms.Commands()
+	prefix := fmt.Sprintf("jdev/sps/updateuserpwdh/%s/", testUUIDString)
+	if len(cmds) != 1 || !strings.HasPrefix(cmds[0], prefix) {
+		t.Fatalf("commands = %q, want %s...", cmds, prefix)
+	}
+	parts := strings.Split(strings.TrimPrefix(cmds[0], prefix), ":")
+	if len(parts) != 2 || len(parts[1]) != 32 {
+		t.Fatalf("invalid password hash %q", cmds[0])
+	}
+	hash := sha1.Sum([]byte("secret:" + parts[1]))
+	if want := strings.ToUpper(hex.EncodeToString(hash[:])); parts[0] != want {
+		t.Errorf("password hash = %s, want %s", parts[0], want)
+	}
+}
+
+func TestCheckAccess(t *testing.T) {
+	var app3 map[string]interface{}
+	err := json.Unmarshal([]byte(`{"controls":{
+		"0f1e2d3c-0001-0000-ffff000000000000":{"name":"Light","uuidAction":"0f1e2d3c-0001-0000-ffff000000000000","states":{"active":"0f1e2d3c-0002-0000-ffff000000000000"}},
+		"0f1e2d3c-0003-0000-ffff000000000000":{"name":"Lighting","subControls":{
+			"0f1e2d3c-0003-0000-ffff000000000000/AI1":{"name":"Dimmer","states":{"position":"0f1e2d3c-0004-0000-ffff000000000000"}}
+		}}
+	}}`), &app3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := &WebSocket{username: "guest"}
+	errs := socket.CheckAccess(app3,
+		"0f1e2d3c-0001-0000-ffff000000000000",
+		"0f1e2d3c-0002-0000-ffff000000000000",
+		"0f1e2d3c-0003-0000-ffff000000000000/AI1",
+		"0f1e2d3c-0004-0000-ffff000000000000",
+		"0f1e2d3c-0001-0000-ffff000000000000/on",
+	)
+	if len(errs) != 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+
+	errs = socket.CheckAccess(app3, "0f1e2d3c-0002-0000-ffff000000000000", "0f1e2d3c-0005-0000-ffff000000000000", "0f1e2d3c-0006-0000-ffff000000000000/on")
+	want := []string{
+		"no access to 0f1e2d3c-0005-0000-ffff000000000000 for user guest",
+		"no access to 0f1e2d3c-0006-0000-ffff000000000000/on for user guest",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("errors = %v, want %q", errs, want)
+	}
+	for i, err := range errs {
+		if err.Error() != want[i] {
+			t.Errorf("error = %q, want %q", err, want[i])
+		}
+	}
+}
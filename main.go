@@ -29,6 +29,10 @@ func main() {
 
 	log.Println("app3 last modified:", app3["lastModified"])
 
+	for _, err := range ws.CheckAccess(app3, "106e6773-02a9-e641-ffff20df2fc4e78a", "106e6773-02a9-e657-ffff403fb0c34b9e/AI2") {
+		log.Println("warning:", err)
+	}
+
 	ch := ws.Subscribe("106e6773-02a9-e641-ffff20df2fc4e78a")
 
 	err = ws.EnableStatusUpdate()
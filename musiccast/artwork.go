@@ -0,0 +1,243 @@
+package musiccast
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+const (
+	// MaxArtworkSize is the size of the largest image fetched.
+	MaxArtworkSize = 2 << 20
+	// DefaultArtworkCacheSize is the total image size kept by the DefaultArtworkCache.
+	DefaultArtworkCacheSize = 16 << 20
+)
+
+// Artwork is an album art image, identified by the SHA-256 hash of its data.
+type Artwork struct {
+	Hash        string
+	ContentType string
+	Data        []byte
+}
+
+// ArtworkEvent notifies that the artwork of the track played by a device changed.
+// The artwork is empty for tracks without artwork, Err is set if it could not be fetched.
+type ArtworkEvent struct {
+	DeviceID string
+	Artwork  Artwork
+	Err      error
+}
+
+// ArtworkCache is a content-addressed cache of images, evicting the least
+// recently used ones once their total size exceeds the limit.
+type ArtworkCache struct {
+	maxSize int
+	size    int
+	lru     *list.List
+	entries map[string]*list.Element
+	mutex   sync.Mutex
+}
+
+// DefaultArtworkCache caches the artwork fetched by all devices.
+var DefaultArtworkCache = NewArtworkCache(DefaultArtworkCacheSize)
+
+// artwork remembers the artwork of the track played by a device.
+type artwork struct {
+	mutex sync.Mutex
+	track string
+	hash  string
+	// cancel cancels the fetch started for the last track change.
+	cancel context.CancelFunc
+}
+
+// NewArtworkCache creates a new ArtworkCache holding at most maxSize bytes of images.
+func NewArtworkCache(maxSize int) *ArtworkCache {
+	return &ArtworkCache{maxSize: maxSize, lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Get returns a copy of the image with the given hash.
+func (c *ArtworkCache) Get(hash string) (a Artwork, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e, ok := c.entries[hash]; ok {
+		c.lru.MoveToFront(e)
+		return e.Value.(Artwork).copy(), true
+	}
+	return a, false
+}
+
+// Put adds a copy of the image to the cache, unless it is larger than the cache itself.
+func (c *ArtworkCache) Put(a Artwork) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e, ok := c.entries[a.Hash]; ok {
+		c.lru.MoveToFront(e)
+		return
+	}
+	if len(a.Data) > c.maxSize {
+		return
+	}
+	c.entries[a.Hash] = c.lru.PushFront(a.copy())
+	c.size += len(a.Data)
+	for c.size > c.maxSize {
+		e := c.lru.Back()
+		evicted := c.lru.Remove(e).(Artwork)
+		delete(c.entries, evicted.Hash)
+		c.size -= len(evicted.Data)
+	}
+}
+
+// Len returns the number of cached images.
+func (c *ArtworkCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lru.Len()
+}
+
+// AlbumArtURL returns the absolute URL of the album art of the current track, or nil if it has none.
+func (d *Device) AlbumArtURL() (u *url.URL, err error) {
+	return d.resolveAlbumArt(d.GetPlayback().AlbumArtURL)
+}
+
+// AlbumArt returns the album art of the current track, fetching it unless it is cached.
+// The artwork is empty if the track has none.
+func (d *Device) AlbumArt() (a Artwork, err error) {
+	playback := d.GetPlayback()
+	track := trackKey(playback)
+
+	d.artwork.mutex.Lock()
+	hash := d.artwork.hash
+	cached := d.artwork.track == track
+	d.artwork.mutex.Unlock()
+	if cached {
+		if a, ok := DefaultArtworkCache.Get(hash); ok || hash == "" {
+			return a, nil
+		}
+	}
+
+	a, err = d.fetchAlbumArt(playback.AlbumArtURL)
+	if err == nil {
+		d.artwork.mutex.Lock()
+		d.artwork.track = track
+		d.artwork.hash = a.Hash
+		d.artwork.mutex.Unlock()
+	}
+
+	return a, err
+}
+
+// SubscribeArtwork returns a channel receiving an ArtworkEvent whenever the played track changes.
+func (d *Device) SubscribeArtwork() chan interface{} {
+	return broker.Sub(artworkTopic(d.id))
+}
+
+// startArtworkUpdate cancels the pending artwork update and starts one for the given track.
+func (d *Device) startArtworkUpdate(playback Playback) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.artwork.mutex.Lock()
+	if d.artwork.cancel != nil {
+		d.artwork.cancel()
+	}
+	d.artwork.cancel = cancel
+	d.artwork.mutex.Unlock()
+
+	go func() {
+		defer cancel()
+		(&Device{d.device, ctx}).updateArtwork(playback)
+	}()
+}
+
+// updateArtwork fetches the artwork of the given track and publishes it,
+// unless another track started playing in the meantime.
+func (d *Device) updateArtwork(playback Playback) {
+	a, err := d.fetchAlbumArt(playback.AlbumArtURL)
+	if d.Context().Err() != nil {
+		return
+	}
+
+	d.mutex.RLock()
+	id := d.id
+	current := trackKey(d.state.Playback) == trackKey(playback)
+	d.mutex.RUnlock()
+	if !current {
+		return
+	}
+
+	if err == nil {
+		d.artwork.mutex.Lock()
+		d.artwork.track = trackKey(playback)
+		d.artwork.hash = a.Hash
+		d.artwork.mutex.Unlock()
+	}
+	broker.Pub(ArtworkEvent{id, a, err}, artworkTopic(id))
+}
+
+func (d *Device) fetchAlbumArt(albumArtURL string) (a Artwork, err error) {
+	u, err := d.resolveAlbumArt(albumArtURL)
+	if err != nil || u == nil {
+		return a, err
+	}
+	req, err := d.newURLRequest("GET", u.String(), nil)
+	if err != nil {
+		return a, err
+	}
+	resp, err := d.do(req)
+	if err != nil {
+		return a, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return a, &StatusError{u.Path, resp.StatusCode}
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxArtworkSize+1))
+	if err == nil && len(data) > MaxArtworkSize {
+		err = fmt.Errorf("album art %s larger than %d bytes", u, MaxArtworkSize)
+	}
+	if err == nil {
+		sum := sha256.Sum256(data)
+		a = Artwork{hex.EncodeToString(sum[:]), resp.Header.Get("Content-Type"), data}
+		if a.ContentType == "" {
+			a.ContentType = http.DetectContentType(data)
+		}
+		DefaultArtworkCache.Put(a)
+	}
+
+	return a, err
+}
+
+// resolveAlbumArt resolves the album art path reported by the device against the device address.
+func (d *Device) resolveAlbumArt(albumArtURL string) (u *url.URL, err error) {
+	if albumArtURL == "" {
+		return nil, nil
+	}
+	ref, err := url.Parse(albumArtURL)
+	if err == nil {
+		base := d.baseURL()
+		base.Path = "/"
+		u = base.ResolveReference(ref)
+	}
+
+	return u, err
+}
+
+// trackKey identifies the track played, the album art URL alone is the same for all tracks on most devices.
+func trackKey(p Playback) string {
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s", p.Input, p.Artist, p.Album, p.Track, p.AlbumArtURL)
+}
+
+func (a Artwork) copy() Artwork {
+	a.Data = append([]byte(nil), a.Data...)
+	return a
+}
+
+func artworkTopic(deviceID string) string {
+	return deviceID + "/artwork"
+}
@@ -0,0 +1,200 @@
+package musiccast
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TransportStopped       = "STOPPED"
+	TransportPlaying       = "PLAYING"
+	TransportPaused        = "PAUSED_PLAYBACK"
+	TransportTransitioning = "TRANSITIONING"
+	TransportNoMedia       = "NO_MEDIA_PRESENT"
+)
+
+// notificationPollInterval is the interval the transport state is checked at while playing a notification.
+const notificationPollInterval = 500 * time.Millisecond
+
+// TransportInfo is the UPnP AVTransport state.
+type TransportInfo struct {
+	State  string `json:"state"`
+	Status string `json:"status"`
+	Speed  string `json:"speed"`
+}
+
+// TransportPosition is the UPnP AVTransport position of the current track.
+type TransportPosition struct {
+	Track    uint32        `json:"track"`
+	URI      string        `json:"uri"`
+	Duration time.Duration `json:"duration"`
+	Elapsed  time.Duration `json:"elapsed"`
+}
+
+// DIDLLite returns DIDL-Lite metadata describing an audio item at the given URL.
+func DIDLLite(title, uri, mimeType string) string {
+	var b bytes.Buffer
+	escape := func(s string) string {
+		b.Reset()
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	return fmt.Sprintf(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">`+
+		`<item id="0" parentID="-1" restricted="1"><dc:title>%s</dc:title><upnp:class>object.item.audioItem.musicTrack</upnp:class>`+
+		`<res protocolInfo="http-get:*:%s:*">%s</res></item></DIDL-Lite>`, escape(title), escape(mimeType), escape(uri))
+}
+
+// PlayURL plays the media at the given URL with the given DIDL-Lite metadata.
+func (d *Device) PlayURL(uri, metadata string) (err error) {
+	avTransport := d.transport()
+	if avTransport == nil {
+		return unsupported("avtransport")
+	}
+	err = avTransport.SetAVTransportURI(0, uri, metadata)
+	if err == nil {
+		err = avTransport.Play(0, "1")
+	}
+
+	return err
+}
+
+// StopURL stops playing the media set with PlayURL.
+func (d *Device) StopURL() (err error) {
+	avTransport := d.transport()
+	if avTransport == nil {
+		return unsupported("avtransport")
+	}
+	return avTransport.Stop(0)
+}
+
+// GetTransportInfo returns the UPnP AVTransport state.
+func (d *Device) GetTransportInfo() (info TransportInfo, err error) {
+	avTransport := d.transport()
+	if avTransport == nil {
+		return info, unsupported("avtransport")
+	}
+	info.State, info.Status, info.Speed, err = avTransport.GetTransportInfo(0)
+	return info, err
+}
+
+// GetTransportPosition returns the UPnP AVTransport position of the current track.
+func (d *Device) GetTransportPosition() (pos TransportPosition, err error) {
+	avTransport := d.transport()
+	if avTransport == nil {
+		return pos, unsupported("avtransport")
+	}
+	var duration, elapsed string
+	pos.Track, duration, _, pos.URI, elapsed, _, _, _, err = avTransport.GetPositionInfo(0)
+	if err == nil {
+		pos.Duration = parseTransportTime(duration)
+		pos.Elapsed = parseTransportTime(elapsed)
+	}
+
+	return pos, err
+}
+
+// PlayNotification plays a short clip such as a doorbell chime at the given
+// volume and restores the previous power, input, volume and playback state
+// once the clip has finished or the timeout has expired. A volume of 0 keeps
+// the current volume.
+//
+// Notifications played on the same device are played one after the other.
+func (d *Device) PlayNotification(uri, metadata string, volume uint8, timeout time.Duration) (err error) {
+	d.notification.Lock()
+	defer d.notification.Unlock()
+	main := d.zone(MainZone)
+	snapshot := d.Snapshot()
+
+	if main.GetStatus().Power != PowerOn {
+		err = main.SetPower(PowerOn)
+	}
+	if err == nil && volume > 0 {
+		err = main.SetVolume(volume)
+	}
+	if err == nil {
+		err = d.PlayURL(uri, metadata)
+	}
+	if err == nil {
+		err = d.waitForTransport(uri, timeout)
+	}
+
+	if restoreErr := d.Restore(snapshot); err == nil {
+		err = restoreErr
+	}
+
+	return err
+}
+
+// PlayNotification plays the clip on all the given devices at once, see Device.PlayNotification.
+func PlayNotification(devices []*Device, uri, metadata string, volume uint8, timeout time.Duration) (err error) {
+	var wg sync.WaitGroup
+	errs := make([]error, len(devices))
+	for i, d := range devices {
+		wg.Add(1)
+		go func(i int, d *Device) {
+			defer wg.Done()
+			errs[i] = d.PlayNotification(uri, metadata, volume, timeout)
+		}(i, d)
+	}
+	wg.Wait()
+
+	for i, e := range errs {
+		if e != nil {
+			return fmt.Errorf("%s: %v", devices[i].GetNetworkName(), e)
+		}
+	}
+	return nil
+}
+
+// waitForTransport waits for the transport to finish playing the given uri, or the device context to be done.
+//
+// Clips shorter than the poll interval are never seen playing, so the transport being stopped
+// or switched to another uri is taken as the end of the clip as well.
+func (d *Device) waitForTransport(uri string, timeout time.Duration) (err error) {
+	ctx := d.Context()
+	deadline := time.Now().Add(timeout)
+	started := false
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(notificationPollInterval):
+		}
+		var info TransportInfo
+		info, err = d.GetTransportInfo()
+		if err != nil {
+			return err
+		}
+		var pos TransportPosition
+		pos, err = d.GetTransportPosition()
+		if err != nil {
+			return err
+		}
+		switch {
+		case pos.URI != uri:
+			return nil
+		case info.State == TransportPlaying || info.State == TransportTransitioning:
+			started = true
+		case info.State == TransportStopped || info.State == TransportNoMedia || started:
+			return nil
+		}
+	}
+	return nil
+}
+
+func parseTransportTime(s string) (d time.Duration) {
+	parts := strings.Split(strings.SplitN(s, ".", 2)[0], ":")
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		d = d*60 + time.Duration(n)
+	}
+	return d * time.Second
+}
@@ -0,0 +1,127 @@
+package musiccast
+
+// BluetoothInfo is the Bluetooth state of a device.
+type BluetoothInfo struct {
+	Standby   bool            `json:"bluetooth_standby"`
+	TxSetting bool            `json:"bluetooth_tx_setting"`
+	Device    BluetoothDevice `json:"bluetooth_device"`
+}
+
+// BluetoothDevice is a Bluetooth device paired with or connected to a device.
+type BluetoothDevice struct {
+	Address   string `json:"address"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Connected bool   `json:"connected"`
+}
+
+// Bluetooth controls the Bluetooth of a Device.
+type Bluetooth struct {
+	device *Device
+}
+
+// Bluetooth returns the Bluetooth controls of the device.
+func (d *Device) Bluetooth() *Bluetooth {
+	return &Bluetooth{d}
+}
+
+// GetInfo returns the Bluetooth state.
+func (b *Bluetooth) GetInfo() BluetoothInfo {
+	b.device.mutex.RLock()
+	defer b.device.mutex.RUnlock()
+	return b.device.state.Bluetooth
+}
+
+// SetTransmission enables and disables transmitting audio to a Bluetooth device.
+func (b *Bluetooth) SetTransmission(enable bool) (err error) {
+	if !b.device.GetFeatures().HasFunc("bluetooth_tx_setting") {
+		return unsupported("bluetooth transmission")
+	}
+	return b.call("system/setBluetoothTxSetting", map[string]interface{}{"enable": enable})
+}
+
+// SetStandby enables and disables waking up the device from Bluetooth.
+func (b *Bluetooth) SetStandby(enable bool) (err error) {
+	if !b.device.GetFeatures().HasFunc("bluetooth_standby") {
+		return unsupported("bluetooth standby")
+	}
+	return b.call("system/setBluetoothStandby", map[string]interface{}{"enable": enable})
+}
+
+// UpdateDevices starts searching for Bluetooth devices to transmit to.
+func (b *Bluetooth) UpdateDevices() (err error) {
+	return b.call("system/updateBluetoothDeviceList", nil)
+}
+
+// GetDevices returns the Bluetooth devices found by the last search.
+func (b *Bluetooth) GetDevices() (devices []BluetoothDevice, err error) {
+	if err = b.require(); err != nil {
+		return devices, err
+	}
+	resp, err := b.device.request("GET", "system/getBluetoothDeviceList")
+	if err == nil {
+		var data map[string]interface{}
+		data, err = decodeResponse(resp)
+		if err == nil {
+			var list struct {
+				Devices []BluetoothDevice `json:"device_list"`
+			}
+			err = updateIn(&list, data)
+			devices = list.Devices
+		}
+	}
+
+	return devices, err
+}
+
+// Connect connects to the Bluetooth device with the given address.
+func (b *Bluetooth) Connect(address string) (err error) {
+	return b.call("system/connectBluetoothDevice", map[string]interface{}{"address": address})
+}
+
+// Disconnect disconnects the connected Bluetooth device.
+func (b *Bluetooth) Disconnect() (err error) {
+	return b.call("system/disconnectBluetoothDevice", nil)
+}
+
+func (b *Bluetooth) require() (err error) {
+	if !b.device.GetFeatures().supportsBluetooth() {
+		err = unsupported("bluetooth")
+	}
+
+	return err
+}
+
+func (b *Bluetooth) call(p string, params map[string]interface{}) (err error) {
+	if err = b.require(); err != nil {
+		return err
+	}
+	resp, err := b.device.requestWithParams("GET", p, params)
+	if err == nil {
+		_, err = decodeResponse(resp)
+	}
+
+	return err
+}
+
+func (f Features) supportsBluetooth() bool {
+	_, ok := f.Input(InputBluetooth)
+	return ok || f.HasFunc("bluetooth_tx_setting") || f.HasFunc("bluetooth_standby")
+}
+
+func (d *Device) fetchBluetoothInfo() (err error) {
+	resp, err := d.request("GET", "system/getBluetoothInfo")
+	if err == nil {
+		var data map[string]interface{}
+		data, err = decodeResponse(resp)
+		if err == nil {
+			var info BluetoothInfo
+			err = updateIn(&info, data)
+			if err == nil {
+				d.state.Bluetooth = info
+			}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,335 @@
+package musiccast
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ListPageSize is the number of list items fetched at once, the maximum the devices accept.
+const ListPageSize = 8
+
+const (
+	attributeSelectable = 0x2
+	attributePlayable   = 0x4
+)
+
+const (
+	PlayQueuePlay     = "play"
+	PlayQueueRemove   = "remove"
+	PlayQueueMoveUp   = "move_up"
+	PlayQueueMoveDown = "move_down"
+	PlayQueueClear    = "clear"
+)
+
+// ListItem is an item of a Net/USB list.
+type ListItem struct {
+	Text      string `json:"text"`
+	Thumbnail string `json:"thumbnail"`
+	Attribute uint32 `json:"attribute"`
+}
+
+// ListInfo is a page of the Net/USB list currently browsed.
+type ListInfo struct {
+	Input        string     `json:"input"`
+	MenuLayer    int        `json:"menu_layer"`
+	MaxLine      int        `json:"max_line"`
+	Index        int        `json:"index"`
+	PlayingIndex int        `json:"playing_index"`
+	MenuName     string     `json:"menu_name"`
+	Items        []ListItem `json:"list_info"`
+}
+
+// Preset is a Net/USB preset.
+type Preset struct {
+	Input     string `json:"input"`
+	Text      string `json:"text"`
+	Attribute uint32 `json:"attribute"`
+}
+
+// RecentItem is a recently played Net/USB item.
+type RecentItem struct {
+	Input       string `json:"input"`
+	Text        string `json:"text"`
+	AlbumArtURL string `json:"albumart_url"`
+	PlayCount   int    `json:"play_count"`
+	Attribute   uint32 `json:"attribute"`
+}
+
+// PlayQueue is the Net/USB play queue.
+type PlayQueue struct {
+	Index        int        `json:"index"`
+	MaxLine      int        `json:"max_line"`
+	PlayingIndex int        `json:"playing_index"`
+	Items        []ListItem `json:"play_queue"`
+}
+
+// Browser navigates the Net/USB lists, presets, recent items and play queue of a Device.
+type Browser struct {
+	device *Device
+	zone   string
+	list   *browserList
+}
+
+// browserList is the list being browsed, shared by the browsers of a device.
+type browserList struct {
+	mutex sync.Mutex
+	info  ListInfo
+}
+
+// Browser returns the Net/USB browser of the device.
+func (d *Device) Browser() *Browser {
+	return &Browser{d, MainZone, d.browser}
+}
+
+// IsSelectable reports whether the item is a list that can be selected.
+func (item ListItem) IsSelectable() bool {
+	return item.Attribute&attributeSelectable != 0
+}
+
+// IsPlayable reports whether the item can be played.
+func (item ListItem) IsPlayable() bool {
+	return item.Attribute&attributePlayable != 0
+}
+
+// Open starts browsing the given input and returns the first page of its list.
+func (b *Browser) Open(input string) (list ListInfo, err error) {
+	if err = b.device.requireNetUSB(); err != nil {
+		return list, err
+	}
+	b.list.mutex.Lock()
+	defer b.list.mutex.Unlock()
+	return b.fetchList(input, 0)
+}
+
+// GetList returns the current page of the list being browsed.
+func (b *Browser) GetList() ListInfo {
+	b.list.mutex.Lock()
+	defer b.list.mutex.Unlock()
+	return b.list.info
+}
+
+// Page returns the page of the current list starting at the given index.
+func (b *Browser) Page(index int) (list ListInfo, err error) {
+	b.list.mutex.Lock()
+	defer b.list.mutex.Unlock()
+	if b.list.info.Input == "" {
+		return list, fmt.Errorf("browser not opened")
+	}
+	if index < 0 || (index >= b.list.info.MaxLine && index > 0) {
+		return b.list.info, fmt.Errorf("invalid list index %d", index)
+	}
+	return b.fetchList(b.list.info.Input, index)
+}
+
+// NextPage returns the page following the current one.
+func (b *Browser) NextPage() (list ListInfo, err error) {
+	return b.Page(b.GetList().Index + ListPageSize)
+}
+
+// PreviousPage returns the page preceding the current one.
+func (b *Browser) PreviousPage() (list ListInfo, err error) {
+	index := b.GetList().Index - ListPageSize
+	if index < 0 {
+		index = 0
+	}
+	return b.Page(index)
+}
+
+// Select enters the list item at the given index and returns the first page of its list.
+func (b *Browser) Select(index int) (list ListInfo, err error) {
+	return b.control("select", index)
+}
+
+// Return leaves the current list and returns the first page of its parent.
+func (b *Browser) Return() (list ListInfo, err error) {
+	return b.control("return", -1)
+}
+
+// Play plays the list item at the given index.
+func (b *Browser) Play(index int) (err error) {
+	_, err = b.control("play", index)
+	return err
+}
+
+// GetPresets returns the Net/USB presets.
+func (b *Browser) GetPresets() []Preset {
+	b.device.mutex.RLock()
+	defer b.device.mutex.RUnlock()
+	return b.device.state.Presets
+}
+
+// RecallPreset plays the preset with the given number, starting at 1.
+func (b *Browser) RecallPreset(num int) (err error) {
+	if err = b.checkPreset(num); err == nil {
+		params := map[string]interface{}{"zone": b.zone, "num": num}
+		err = b.call("netusb/recallPreset", params)
+	}
+
+	return err
+}
+
+// StorePreset stores the current playback as the preset with the given number, starting at 1.
+func (b *Browser) StorePreset(num int) (err error) {
+	if err = b.checkPreset(num); err == nil {
+		params := map[string]interface{}{"num": num}
+		err = b.call("netusb/storePreset", params)
+	}
+
+	return err
+}
+
+// GetRecentItems returns the recently played items.
+func (b *Browser) GetRecentItems() []RecentItem {
+	b.device.mutex.RLock()
+	defer b.device.mutex.RUnlock()
+	return b.device.state.RecentItems
+}
+
+// RecallRecentItem plays the recent item with the given number, starting at 1.
+func (b *Browser) RecallRecentItem(num int) (err error) {
+	if err = b.device.requireNetUSB(); err == nil {
+		params := map[string]interface{}{"zone": b.zone, "num": num}
+		err = b.call("netusb/recallRecentItem", params)
+	}
+
+	return err
+}
+
+// GetPlayQueue returns the play queue.
+func (b *Browser) GetPlayQueue() PlayQueue {
+	b.device.mutex.RLock()
+	defer b.device.mutex.RUnlock()
+	return b.device.state.PlayQueue
+}
+
+// ManagePlayQueue applies the given action ("play", "remove", "move_up", "move_down" or "clear")
+// to the play queue item at the given index.
+func (b *Browser) ManagePlayQueue(action string, index int) (err error) {
+	if err = b.device.requireNetUSB(); err == nil {
+		params := map[string]interface{}{"list_id": "play_queue", "type": action, "index": index, "zone": b.zone}
+		err = b.call("netusb/manageList", params)
+	}
+
+	return err
+}
+
+func (b *Browser) control(action string, index int) (list ListInfo, err error) {
+	b.list.mutex.Lock()
+	defer b.list.mutex.Unlock()
+	if b.list.info.Input == "" {
+		return list, fmt.Errorf("browser not opened")
+	}
+	params := map[string]interface{}{"list_id": "main", "type": action, "zone": b.zone}
+	if index >= 0 {
+		params["index"] = index
+	}
+	err = b.call("netusb/setListControl", params)
+	if err == nil && action != "play" {
+		list, err = b.fetchList(b.list.info.Input, 0)
+	}
+
+	return list, err
+}
+
+func (b *Browser) fetchList(input string, index int) (list ListInfo, err error) {
+	params := map[string]interface{}{"input": input, "index": index, "size": ListPageSize, "lang": "en"}
+	resp, err := b.device.requestWithParams("GET", "netusb/getListInfo", params)
+	if err == nil {
+		var data map[string]interface{}
+		data, err = decodeResponse(resp)
+		if err == nil {
+			err = updateIn(&list, data)
+			if err == nil {
+				b.list.info = list
+			}
+		}
+	}
+
+	return list, err
+}
+
+// refresh fetches the current page again after the device reported a list change.
+func (b *Browser) refresh() (err error) {
+	b.list.mutex.Lock()
+	defer b.list.mutex.Unlock()
+	if b.list.info.Input != "" {
+		_, err = b.fetchList(b.list.info.Input, b.list.info.Index)
+	}
+
+	return err
+}
+
+func (b *Browser) checkPreset(num int) (err error) {
+	features := b.device.GetFeatures()
+	if features.NetUSB == nil {
+		err = unsupported("netusb")
+	} else if num < 1 || (features.NetUSB.Preset.Num > 0 && num > features.NetUSB.Preset.Num) {
+		err = fmt.Errorf("invalid preset %d", num)
+	}
+
+	return err
+}
+
+func (b *Browser) call(p string, params map[string]interface{}) (err error) {
+	resp, err := b.device.requestWithParams("GET", p, params)
+	if err == nil {
+		_, err = decodeResponse(resp)
+	}
+
+	return err
+}
+
+func (d *Device) fetchPresets() (err error) {
+	resp, err := d.request("GET", "netusb/getPresetInfo")
+	if err == nil {
+		var data map[string]interface{}
+		data, err = decodeResponse(resp)
+		if err == nil {
+			var info struct {
+				Presets []Preset `json:"preset_info"`
+			}
+			err = updateIn(&info, data)
+			if err == nil {
+				d.state.Presets = info.Presets
+			}
+		}
+	}
+
+	return err
+}
+
+func (d *Device) fetchRecentItems() (err error) {
+	resp, err := d.request("GET", "netusb/getRecentInfo")
+	if err == nil {
+		var data map[string]interface{}
+		data, err = decodeResponse(resp)
+		if err == nil {
+			var info struct {
+				RecentItems []RecentItem `json:"recent_info"`
+			}
+			err = updateIn(&info, data)
+			if err == nil {
+				d.state.RecentItems = info.RecentItems
+			}
+		}
+	}
+
+	return err
+}
+
+func (d *Device) fetchPlayQueue() (err error) {
+	resp, err := d.request("GET", "netusb/getPlayQueue")
+	if err == nil {
+		var data map[string]interface{}
+		data, err = decodeResponse(resp)
+		if err == nil {
+			var queue PlayQueue
+			err = updateIn(&queue, data)
+			if err == nil {
+				d.state.PlayQueue = queue
+			}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,116 @@
+package musiccast
+
+// CDPlayback is the CD player play info.
+type CDPlayback struct {
+	DeviceStatus string `json:"device_status"`
+	Playback     string `json:"playback"`
+	Repeat       string `json:"repeat"`
+	Shuffle      string `json:"shuffle"`
+	PlayTime     int32  `json:"play_time"`
+	TotalTime    int32  `json:"total_time"`
+	DiscTime     int32  `json:"disc_time"`
+	TrackNumber  int    `json:"track_number"`
+	TotalTracks  int    `json:"total_tracks"`
+	Artist       string `json:"artist"`
+	Album        string `json:"album"`
+	Track        string `json:"track"`
+}
+
+// CD controls the CD player of a Device.
+type CD struct {
+	device *Device
+}
+
+// CD returns the CD player of the device.
+func (d *Device) CD() *CD {
+	return &CD{d}
+}
+
+// GetPlayback returns the CD player play info.
+func (c *CD) GetPlayback() CDPlayback {
+	c.device.mutex.RLock()
+	defer c.device.mutex.RUnlock()
+	return c.device.state.CD
+}
+
+// Play begins playback of the current track.
+func (c *CD) Play() (err error) {
+	return c.setPlayback("play", nil)
+}
+
+// Stop stops playback.
+func (c *CD) Stop() (err error) {
+	return c.setPlayback("stop", nil)
+}
+
+// Pause pauses playback of the current track.
+func (c *CD) Pause() (err error) {
+	return c.setPlayback("pause", nil)
+}
+
+// Next plays the next track.
+func (c *CD) Next() (err error) {
+	return c.setPlayback("next", nil)
+}
+
+// Previous plays the previous track.
+func (c *CD) Previous() (err error) {
+	return c.setPlayback("previous", nil)
+}
+
+// SelectTrack plays the track with the given number, starting at 1.
+func (c *CD) SelectTrack(num int) (err error) {
+	return c.setPlayback("track_select", map[string]interface{}{"num": num})
+}
+
+// ToggleTray opens and closes the disc tray.
+func (c *CD) ToggleTray() (err error) {
+	return c.call("cd/toggleTray", nil)
+}
+
+// ToggleRepeat cycles through the repeat modes.
+func (c *CD) ToggleRepeat() (err error) {
+	return c.call("cd/toggleRepeat", nil)
+}
+
+// ToggleShuffle cycles through the shuffle modes.
+func (c *CD) ToggleShuffle() (err error) {
+	return c.call("cd/toggleShuffle", nil)
+}
+
+func (c *CD) setPlayback(playback string, params map[string]interface{}) (err error) {
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+	params["playback"] = playback
+	return c.call("cd/setPlayback", params)
+}
+
+func (c *CD) call(p string, params map[string]interface{}) (err error) {
+	if _, ok := c.device.GetFeatures().Input(InputCD); !ok {
+		return unsupported("cd")
+	}
+	resp, err := c.device.requestWithParams("GET", p, params)
+	if err == nil {
+		_, err = decodeResponse(resp)
+	}
+
+	return err
+}
+
+func (d *Device) fetchCDPlayback() (err error) {
+	resp, err := d.request("GET", "cd/getPlayInfo")
+	if err == nil {
+		var data map[string]interface{}
+		data, err = decodeResponse(resp)
+		if err == nil {
+			var playback CDPlayback
+			err = updateIn(&playback, data)
+			if err == nil {
+				d.state.CD = playback
+			}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,196 @@
+package musiccast
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTimeout      = 5 * time.Second
+	DefaultRetries      = 2
+	DefaultRetryBackoff = 250 * time.Millisecond
+)
+
+// DefaultHTTPClient is the HTTP client of newly created devices.
+var DefaultHTTPClient = &http.Client{}
+
+// client holds the HTTP settings of a device.
+type client struct {
+	mutex      sync.RWMutex
+	httpClient *http.Client
+	timeout    time.Duration
+	retries    int
+	backoff    time.Duration
+	appPort    int
+}
+
+// soapTransport sends UPnP requests on behalf of a device.
+type soapTransport struct {
+	d *Device
+}
+
+// cancelBody releases the request context once the response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func newClient() *client {
+	return &client{httpClient: DefaultHTTPClient, timeout: DefaultTimeout, retries: DefaultRetries, backoff: DefaultRetryBackoff, appPort: DefaultAppPort}
+}
+
+// WithContext returns a copy of the device whose requests are bound to the given context.
+func (d *Device) WithContext(ctx context.Context) *Device {
+	if ctx == nil {
+		panic("nil context")
+	}
+	return &Device{d.device, ctx}
+}
+
+// Context returns the context of the device requests, which defaults to the background context.
+func (d *Device) Context() context.Context {
+	if d.ctx != nil {
+		return d.ctx
+	}
+	return context.Background()
+}
+
+// SetHTTPClient sets the HTTP client used for the device requests.
+func (d *Device) SetHTTPClient(httpClient *http.Client) {
+	d.client.mutex.Lock()
+	defer d.client.mutex.Unlock()
+	d.client.httpClient = httpClient
+}
+
+// SetTimeout sets the time limit of a single request, including reading the response. Zero means no timeout.
+func (d *Device) SetTimeout(timeout time.Duration) {
+	d.client.mutex.Lock()
+	defer d.client.mutex.Unlock()
+	d.client.timeout = timeout
+}
+
+// SetRetries sets how many times failed queries are retried, waiting the
+// given backoff before the first retry and doubling it for every further one.
+// Only queries are retried, as they have no side effects: the YXC "get" requests
+// and the album art downloads. Commands and UPnP requests are sent once.
+func (d *Device) SetRetries(retries int, backoff time.Duration) {
+	d.client.mutex.Lock()
+	defer d.client.mutex.Unlock()
+	d.client.retries = retries
+	d.client.backoff = backoff
+}
+
+// SetAppPort sets the port the device is asked to send its events to. Zero disables events.
+// Listeners set it for the devices of their registry.
+func (d *Device) SetAppPort(port int) {
+	d.client.mutex.Lock()
+	defer d.client.mutex.Unlock()
+	d.client.appPort = port
+}
+
+func (d *Device) appPort() int {
+	d.client.mutex.RLock()
+	defer d.client.mutex.RUnlock()
+	return d.client.appPort
+}
+
+// do sends the request within the device context and timeout. It is the single path of
+// all HTTP requests to the device except the UPnP ones, which go through soapTransport.
+// Queries that failed temporarily, either with a transport error, an HTTP error status or
+// a temporary YXC response code, are retried.
+func (d *Device) do(req *http.Request) (resp *http.Response, err error) {
+	d.client.mutex.RLock()
+	httpClient, timeout, retries, backoff := d.client.httpClient, d.client.timeout, d.client.retries, d.client.backoff
+	d.client.mutex.RUnlock()
+
+	extendedControl := d.isExtendedControl(req.URL)
+	if req.Method != "GET" || (extendedControl && !strings.HasPrefix(path.Base(req.URL.Path), "get")) {
+		retries = 0
+	}
+
+	ctx := d.Context()
+	for attempt := 0; ; attempt++ {
+		d.activity.touchRequest()
+		resp, err = d.send(req, httpClient, timeout)
+
+		retry := attempt < retries && ctx.Err() == nil
+		if retry && err == nil {
+			retry = temporaryStatus(resp.StatusCode) || (extendedControl && temporaryResponse(resp))
+		}
+		if !retry {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff << uint(attempt)):
+		}
+	}
+}
+
+// isExtendedControl reports whether the given URL is a YXC request to the device.
+func (d *Device) isExtendedControl(u *url.URL) bool {
+	base := d.baseURL()
+	return u.Host == base.Host && strings.HasPrefix(u.Path, base.Path)
+}
+
+// send sends the request once within the device context and the given timeout.
+func (d *Device) send(req *http.Request, httpClient *http.Client, timeout time.Duration) (resp *http.Response, err error) {
+	ctx, cancel := d.Context(), context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	resp, err = httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{resp.Body, cancel}
+	return resp, nil
+}
+
+// RoundTrip sends the UPnP requests of the device with its HTTP client, context and timeout.
+func (t soapTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	t.d.client.mutex.RLock()
+	httpClient, timeout := t.d.client.httpClient, t.d.client.timeout
+	t.d.client.mutex.RUnlock()
+	return t.d.send(req, httpClient, timeout)
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func temporaryStatus(code int) bool {
+	return (&StatusError{StatusCode: code}).Temporary()
+}
+
+// temporaryResponse reports whether the response has a temporary YXC response code,
+// leaving the body to be read again.
+func temporaryResponse(resp *http.Response) bool {
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	var body struct {
+		ResponseCode int `json:"response_code"`
+	}
+	if err != nil || json.Unmarshal(data, &body) != nil {
+		return false
+	}
+	return (&ResponseError{Code: body.ResponseCode}).Temporary()
+}
@@ -0,0 +1,263 @@
+package musiccast
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	AlarmModeOneDay = "oneday"
+	AlarmModeWeekly = "weekly"
+)
+
+const (
+	AlarmPlaybackResume = "resume"
+	AlarmPlaybackPreset = "preset"
+)
+
+// weekdays are the alarm day keys indexed by time.Weekday.
+var weekdays = [7]string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+// ClockSettings are the clock and alarm settings of a device.
+type ClockSettings struct {
+	AutoSync bool   `json:"auto_sync"`
+	Format   string `json:"format"`
+	Alarm    Alarm  `json:"alarm"`
+}
+
+// Alarm is the alarm of a device, ringing on a single day or on a weekly schedule.
+type Alarm struct {
+	AlarmOn      bool     `json:"alarm_on"`
+	Volume       int      `json:"volume"`
+	FadeInterval int      `json:"fade_interval"`
+	FadeType     int      `json:"fade_type"`
+	Mode         string   `json:"mode"`
+	Repeat       bool     `json:"repeat"`
+	OneDay       AlarmDay `json:"one_day"`
+	Sunday       AlarmDay `json:"sunday"`
+	Monday       AlarmDay `json:"monday"`
+	Tuesday      AlarmDay `json:"tuesday"`
+	Wednesday    AlarmDay `json:"wednesday"`
+	Thursday     AlarmDay `json:"thursday"`
+	Friday       AlarmDay `json:"friday"`
+	Saturday     AlarmDay `json:"saturday"`
+}
+
+// AlarmDay is the alarm schedule of a day. The alarm either beeps or resumes playback of an input or preset.
+type AlarmDay struct {
+	Enable       bool        `json:"enable"`
+	Time         string      `json:"time"`
+	Beep         bool        `json:"beep"`
+	PlaybackType string      `json:"playback_type"`
+	Resume       AlarmResume `json:"resume"`
+	Preset       AlarmPreset `json:"preset"`
+}
+
+// AlarmResume is the input resumed by an alarm.
+type AlarmResume struct {
+	Input string `json:"input"`
+}
+
+// AlarmPreset is the preset recalled by an alarm.
+type AlarmPreset struct {
+	Type string `json:"type"`
+	Num  int    `json:"num"`
+}
+
+// Clock controls the clock and alarm of a Device.
+type Clock struct {
+	device *Device
+}
+
+// Clock returns the clock of the device.
+func (d *Device) Clock() *Clock {
+	return &Clock{d}
+}
+
+// Day returns the schedule of the given weekday.
+func (a Alarm) Day(day time.Weekday) AlarmDay {
+	return *a.day(day)
+}
+
+// SetDay sets the schedule of the given weekday.
+func (a *Alarm) SetDay(day time.Weekday, schedule AlarmDay) {
+	*a.day(day) = schedule
+}
+
+func (a *Alarm) day(day time.Weekday) *AlarmDay {
+	return [7]*AlarmDay{&a.Sunday, &a.Monday, &a.Tuesday, &a.Wednesday, &a.Thursday, &a.Friday, &a.Saturday}[day]
+}
+
+// TimeOfDay returns the alarm time as the time elapsed since midnight.
+func (d AlarmDay) TimeOfDay() time.Duration {
+	var h, m int
+	fmt.Sscanf(d.Time, "%02d%02d", &h, &m)
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute
+}
+
+// SetTimeOfDay sets the alarm time from the time elapsed since midnight.
+func (d *AlarmDay) SetTimeOfDay(t time.Duration) {
+	d.Time = fmt.Sprintf("%02d%02d", int(t.Hours())%24, int(t.Minutes())%60)
+}
+
+// GetSettings returns the clock and alarm settings.
+func (c *Clock) GetSettings() ClockSettings {
+	c.device.mutex.RLock()
+	defer c.device.mutex.RUnlock()
+	return c.device.state.Clock
+}
+
+// SetAlarm writes the given alarm settings and the schedules of its mode.
+func (c *Clock) SetAlarm(alarm Alarm) (err error) {
+	features, err := c.require("alarm")
+	if err != nil {
+		return err
+	}
+	if err = checkAlarm(features, alarm); err != nil {
+		return err
+	}
+
+	days := map[string]AlarmDay{"oneday": alarm.OneDay}
+	if alarm.Mode == AlarmModeWeekly {
+		days = make(map[string]AlarmDay)
+		for i, day := range weekdays {
+			days[day] = alarm.Day(time.Weekday(i))
+		}
+	}
+	for day, schedule := range days {
+		body := map[string]interface{}{
+			"alarm_on":      alarm.AlarmOn,
+			"volume":        alarm.Volume,
+			"fade_interval": alarm.FadeInterval,
+			"fade_type":     alarm.FadeType,
+			"mode":          alarm.Mode,
+			"repeat":        alarm.Repeat,
+			"detail": map[string]interface{}{
+				"day":           day,
+				"enable":        schedule.Enable,
+				"time":          schedule.Time,
+				"beep":          schedule.Beep,
+				"playback_type": schedule.PlaybackType,
+				"resume":        schedule.Resume,
+				"preset":        schedule.Preset,
+			},
+		}
+		if err = c.post("clock/setAlarmSettings", body); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// EnableAlarm turns the alarm on and off.
+func (c *Clock) EnableAlarm(on bool) (err error) {
+	if _, err = c.require("alarm"); err == nil {
+		err = c.post("clock/setAlarmSettings", map[string]interface{}{"alarm_on": on})
+	}
+
+	return err
+}
+
+// SetAutoSync enables and disables synchronizing the clock with the network.
+func (c *Clock) SetAutoSync(enable bool) (err error) {
+	if _, err = c.require("date_and_time"); err == nil {
+		err = c.call("clock/setAutoSync", map[string]interface{}{"enable": enable})
+	}
+
+	return err
+}
+
+// SetDateAndTime sets the clock to the given time.
+func (c *Clock) SetDateAndTime(t time.Time) (err error) {
+	if _, err = c.require("date_and_time"); err == nil {
+		err = c.call("clock/setDateAndTime", map[string]interface{}{"date_time": t.Format("060102150405")})
+	}
+
+	return err
+}
+
+// require returns the clock capabilities or an error unless the clock supports all the given functions.
+func (c *Clock) require(funcs ...string) (features ClockFeatures, err error) {
+	f := c.device.GetFeatures().Clock
+	if f == nil {
+		return features, unsupported("clock")
+	}
+	for _, fn := range funcs {
+		if !contains(f.FuncList, fn) {
+			return *f, unsupported("clock " + fn)
+		}
+	}
+	return *f, nil
+}
+
+func (c *Clock) call(p string, params map[string]interface{}) (err error) {
+	resp, err := c.device.requestWithParams("GET", p, params)
+	if err == nil {
+		_, err = decodeResponse(resp)
+	}
+
+	return err
+}
+
+func (c *Clock) post(p string, body map[string]interface{}) (err error) {
+	resp, err := c.device.requestWithBody("POST", p, body)
+	if err == nil {
+		_, err = decodeResponse(resp)
+	}
+
+	return err
+}
+
+func checkAlarm(features ClockFeatures, alarm Alarm) (err error) {
+	if len(features.AlarmModeList) > 0 && !contains(features.AlarmModeList, alarm.Mode) {
+		return unsupported("alarm mode " + alarm.Mode)
+	}
+	if r, ok := findRange(features.RangeStep, "alarm_volume"); ok && !r.Contains(float64(alarm.Volume)) {
+		return fmt.Errorf("invalid alarm volume %d, must be between %v and %v", alarm.Volume, r.Min, r.Max)
+	}
+	if r, ok := findRange(features.RangeStep, "alarm_fade"); ok && !r.Contains(float64(alarm.FadeInterval)) {
+		return fmt.Errorf("invalid alarm fade interval %d, must be between %v and %v", alarm.FadeInterval, r.Min, r.Max)
+	}
+	days := []AlarmDay{alarm.OneDay}
+	if alarm.Mode == AlarmModeWeekly {
+		days = nil
+		for i := range weekdays {
+			days = append(days, alarm.Day(time.Weekday(i)))
+		}
+	}
+	for _, day := range days {
+		if !day.Enable || day.Beep {
+			continue
+		}
+		switch day.PlaybackType {
+		case AlarmPlaybackResume:
+			if len(features.AlarmInputList) > 0 && !contains(features.AlarmInputList, day.Resume.Input) {
+				return unsupported("alarm input " + day.Resume.Input)
+			}
+		case AlarmPlaybackPreset:
+			if len(features.AlarmPresetList) > 0 && !contains(features.AlarmPresetList, day.Preset.Type) {
+				return unsupported("alarm preset " + day.Preset.Type)
+			}
+		}
+	}
+
+	return err
+}
+
+func (d *Device) fetchClockSettings() (err error) {
+	resp, err := d.request("GET", "clock/getSettings")
+	if err == nil {
+		var data map[string]interface{}
+		data, err = decodeResponse(resp)
+		if err == nil {
+			var settings ClockSettings
+			err = updateIn(&settings, data)
+			if err == nil {
+				d.state.Clock = settings
+			}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,274 @@
+package musiccast
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+const (
+	RoleServer = "server"
+	RoleClient = "client"
+	RoleNone   = "none"
+)
+
+// DistributionInfo is the multi-room link state of a device.
+type DistributionInfo struct {
+	GroupID    string               `json:"group_id"`
+	GroupName  string               `json:"group_name"`
+	Role       string               `json:"role"`
+	ServerZone string               `json:"server_zone"`
+	ClientList []DistributionClient `json:"client_list"`
+}
+
+// DistributionClient is a client of a multi-room link group.
+type DistributionClient struct {
+	IPAddress string `json:"ip_address"`
+	DataType  string `json:"data_type"`
+}
+
+// GroupEvent notifies a change of the distribution state of a group member.
+type GroupEvent struct {
+	DeviceID string
+	Info     DistributionInfo
+}
+
+// Group is a multi-room link group distributing the audio of a master device to its clients.
+type Group struct {
+	id      string
+	name    string
+	master  *Device
+	clients []*Device
+	num     int
+	mutex   *sync.Mutex
+}
+
+// GetDistributionInfo returns the device multi-room link state.
+func (d *Device) GetDistributionInfo() DistributionInfo {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.state.Distribution
+}
+
+// NewGroup links the given clients to the master device and starts distributing its main zone.
+// If the group cannot be formed, the devices linked so far are unlinked again.
+func NewGroup(name string, master *Device, clients ...*Device) (group *Group, err error) {
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err == nil {
+		group = &Group{id: hex.EncodeToString(id), name: name, master: master, mutex: &sync.Mutex{}}
+		if err = master.requireDistribution(); err == nil {
+			err = group.Add(clients...)
+			if err == nil && name != "" {
+				if err = master.setGroupName(name); err != nil {
+					group.Dissolve()
+				}
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+// GetGroupID returns the group id.
+func (g *Group) GetGroupID() string {
+	return g.id
+}
+
+// GetGroupName returns the group name.
+func (g *Group) GetGroupName() string {
+	return g.name
+}
+
+// GetMaster returns the device distributing its audio.
+func (g *Group) GetMaster() *Device {
+	return g.master
+}
+
+// GetClients returns the devices receiving the distributed audio.
+func (g *Group) GetClients() []*Device {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return append([]*Device(nil), g.clients...)
+}
+
+// Add links the given clients to the group. On error, none of them is linked.
+func (g *Group) Add(clients ...*Device) (err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for _, c := range clients {
+		if err = c.requireDistribution(); err != nil {
+			return err
+		}
+	}
+
+	var linked []*Device
+	for _, c := range clients {
+		if err = c.setClientInfo(g.id, g.master.host()); err != nil {
+			break
+		}
+		linked = append(linked, c)
+	}
+	if err == nil {
+		if err = g.master.setServerInfo(g.id, "add", hosts(clients)); err == nil {
+			if err = g.start(); err != nil {
+				g.master.setServerInfo(g.id, "remove", hosts(clients))
+			}
+		}
+	}
+	if err != nil {
+		for _, c := range linked {
+			c.setClientInfo("", "")
+		}
+		return err
+	}
+
+	g.clients = append(g.clients, clients...)
+	return nil
+}
+
+// Remove unlinks the given clients from the group. The distribution stops once the last client is removed.
+func (g *Group) Remove(clients ...*Device) (err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for _, c := range clients {
+		if err = c.setClientInfo("", ""); err != nil {
+			return err
+		}
+	}
+	if err = g.master.setServerInfo(g.id, "remove", hosts(clients)); err == nil {
+		remaining := g.clients[:0]
+		for _, member := range g.clients {
+			removed := false
+			for _, c := range clients {
+				removed = removed || c.device == member.device
+			}
+			if !removed {
+				remaining = append(remaining, member)
+			}
+		}
+		g.clients = remaining
+		if len(g.clients) == 0 {
+			err = g.stop()
+		} else {
+			err = g.start()
+		}
+	}
+
+	return err
+}
+
+// Dissolve stops the distribution and unlinks all the group members.
+func (g *Group) Dissolve() (err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	err = g.stop()
+	for _, c := range g.clients {
+		if e := c.setClientInfo("", ""); err == nil {
+			err = e
+		}
+	}
+	if e := g.master.setServerInfo("", "remove", hosts(g.clients)); err == nil {
+		err = e
+	}
+	g.clients = nil
+	return err
+}
+
+// Subscribe returns a channel for receiving GroupEvent notifications from the group members.
+func (g *Group) Subscribe() chan interface{} {
+	return broker.Sub(groupTopic(g.id))
+}
+
+func (g *Group) start() (err error) {
+	g.num++
+	params := map[string]interface{}{"num": g.num}
+	resp, err := g.master.requestWithParams("GET", "dist/startDistribution", params)
+	if err == nil {
+		_, err = decodeResponse(resp)
+	}
+
+	return err
+}
+
+func (g *Group) stop() (err error) {
+	resp, err := g.master.request("GET", "dist/stopDistribution")
+	if err == nil {
+		_, err = decodeResponse(resp)
+	}
+
+	return err
+}
+
+func (d *Device) requireDistribution() (err error) {
+	if d.GetFeatures().Distribution == nil {
+		err = unsupported("distribution")
+	}
+
+	return err
+}
+
+func (d *Device) fetchDistributionInfo() (err error) {
+	resp, err := d.request("GET", "dist/getDistributionInfo")
+	if err == nil {
+		var data map[string]interface{}
+		data, err = decodeResponse(resp)
+		if err == nil {
+			var info DistributionInfo
+			err = updateIn(&info, data)
+			if err == nil {
+				d.state.Distribution = info
+			}
+		}
+	}
+
+	return err
+}
+
+func (d *Device) setServerInfo(groupID, action string, clients []string) (err error) {
+	body := map[string]interface{}{"group_id": groupID, "zone": MainZone, "type": action, "client_list": clients}
+	resp, err := d.requestWithBody("POST", "dist/setServerInfo", body)
+	if err == nil {
+		_, err = decodeResponse(resp)
+	}
+
+	return err
+}
+
+func (d *Device) setClientInfo(groupID, server string) (err error) {
+	body := map[string]interface{}{"group_id": groupID, "zone": []string{MainZone}}
+	if server != "" {
+		body["server_ip_address"] = server
+	}
+	resp, err := d.requestWithBody("POST", "dist/setClientInfo", body)
+	if err == nil {
+		_, err = decodeResponse(resp)
+	}
+
+	return err
+}
+
+func (d *Device) setGroupName(name string) (err error) {
+	body := map[string]interface{}{"name": name}
+	resp, err := d.requestWithBody("POST", "dist/setGroupName", body)
+	if err == nil {
+		_, err = decodeResponse(resp)
+	}
+
+	return err
+}
+
+func hosts(devices []*Device) []string {
+	hosts := []string{}
+	for _, d := range devices {
+		hosts = append(hosts, d.host())
+	}
+	return hosts
+}
+
+func groupTopic(groupID string) string {
+	return fmt.Sprintf("group/%s", groupID)
+}
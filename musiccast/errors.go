@@ -0,0 +1,120 @@
+package musiccast
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+)
+
+// YXC response codes.
+const (
+	ResponseOK                  = 0
+	ResponseInitializing        = 1
+	ResponseInternalError       = 2
+	ResponseInvalidRequest      = 3
+	ResponseInvalidParameter    = 4
+	ResponseGuarded             = 5
+	ResponseTimeout             = 6
+	ResponseFirmwareUpdating    = 99
+	ResponseAccessError         = 100
+	ResponseOtherError          = 101
+	ResponseWrongUserName       = 102
+	ResponseWrongPassword       = 103
+	ResponseAccountExpired      = 104
+	ResponseAccountDisconnected = 105
+	ResponseAccountLimitReached = 106
+	ResponseServerMaintenance   = 107
+	ResponseInvalidAccount      = 108
+	ResponseLicenseError        = 109
+	ResponseReadOnlyMode        = 110
+	ResponseMaxStations         = 111
+	ResponseAccessDenied        = 112
+	ResponsePlaylistRequired    = 113
+	ResponseNewPlaylistRequired = 114
+	ResponseLoginLimitReached   = 115
+	ResponseLinkingInProgress   = 200
+	ResponseUnlinkingInProgress = 201
+)
+
+var responseMessages = map[int]string{
+	ResponseInitializing:        "initializing",
+	ResponseInternalError:       "internal error",
+	ResponseInvalidRequest:      "invalid request",
+	ResponseInvalidParameter:    "invalid parameter",
+	ResponseGuarded:             "guarded",
+	ResponseTimeout:             "time out",
+	ResponseFirmwareUpdating:    "firmware updating",
+	ResponseAccessError:         "streaming service access error",
+	ResponseOtherError:          "streaming service error",
+	ResponseWrongUserName:       "wrong user name",
+	ResponseWrongPassword:       "wrong password",
+	ResponseAccountExpired:      "account expired",
+	ResponseAccountDisconnected: "account disconnected",
+	ResponseAccountLimitReached: "account limit reached",
+	ResponseServerMaintenance:   "server maintenance",
+	ResponseInvalidAccount:      "invalid account",
+	ResponseLicenseError:        "license error",
+	ResponseReadOnlyMode:        "read only mode",
+	ResponseMaxStations:         "maximum number of stations reached",
+	ResponseAccessDenied:        "access denied",
+	ResponsePlaylistRequired:    "destination playlist required",
+	ResponseNewPlaylistRequired: "new playlist required",
+	ResponseLoginLimitReached:   "simultaneous login limit reached",
+	ResponseLinkingInProgress:   "linking in progress",
+	ResponseUnlinkingInProgress: "unlinking in progress",
+}
+
+// ResponseError is returned for requests the device answered with a non-zero response code.
+type ResponseError struct {
+	Path string
+	Code int
+}
+
+// StatusError is returned for requests the device answered with an HTTP error status.
+type StatusError struct {
+	Path       string
+	StatusCode int
+}
+
+func (e *ResponseError) Error() string {
+	msg, ok := responseMessages[e.Code]
+	if !ok {
+		msg = "unknown error"
+		if e.Code >= ResponseAccessError {
+			msg = "streaming service error"
+		}
+	}
+	return fmt.Sprintf("extended control error %d on %s: %s", e.Code, e.Path, msg)
+}
+
+// Temporary reports whether the request may succeed when retried later.
+func (e *ResponseError) Temporary() bool {
+	switch e.Code {
+	case ResponseInitializing, ResponseTimeout, ResponseFirmwareUpdating, ResponseLinkingInProgress, ResponseUnlinkingInProgress:
+		return true
+	}
+	return false
+}
+
+// StreamingService reports whether the error originates from a streaming service.
+func (e *ResponseError) StreamingService() bool {
+	return e.Code >= ResponseAccessError
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("extended control request %s failed: %d %s", e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Temporary reports whether the request may succeed when retried later.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// responsePath returns the API path of the request, such as "main/setVolume".
+func responsePath(resp *http.Response) string {
+	if resp.Request == nil || resp.Request.URL == nil {
+		return ""
+	}
+	p := resp.Request.URL.Path
+	return path.Join(path.Base(path.Dir(p)), path.Base(p))
+}
@@ -0,0 +1,238 @@
+package musiccast
+
+import (
+	"fmt"
+)
+
+// Features describes the capabilities reported by the device.
+type Features struct {
+	System       SystemFeatures        `json:"system"`
+	Zones        []ZoneFeatures        `json:"zone"`
+	Tuner        *TunerFeatures        `json:"tuner"`
+	NetUSB       *NetUSBFeatures       `json:"netusb"`
+	Distribution *DistributionFeatures `json:"distribution"`
+	Clock        *ClockFeatures        `json:"clock"`
+}
+
+// SystemFeatures describes the device wide capabilities.
+type SystemFeatures struct {
+	FuncList  []string        `json:"func_list"`
+	ZoneNum   int             `json:"zone_num"`
+	InputList []InputFeatures `json:"input_list"`
+	RangeStep []RangeStep     `json:"range_step"`
+}
+
+// InputFeatures describes an input source.
+type InputFeatures struct {
+	ID                 string `json:"id"`
+	DistributionEnable bool   `json:"distribution_enable"`
+	RenameEnable       bool   `json:"rename_enable"`
+	AccountEnable      bool   `json:"account_enable"`
+	PlayInfoType       string `json:"play_info_type"`
+}
+
+// ZoneFeatures describes the capabilities of a zone.
+type ZoneFeatures struct {
+	ID                   string      `json:"id"`
+	FuncList             []string    `json:"func_list"`
+	InputList            []string    `json:"input_list"`
+	SoundProgramList     []string    `json:"sound_program_list"`
+	ActualVolumeModeList []string    `json:"actual_volume_mode_list"`
+	ToneControlModeList  []string    `json:"tone_control_mode_list"`
+	EqualizerModeList    []string    `json:"equalizer_mode_list"`
+	LinkControlList      []string    `json:"link_control_list"`
+	LinkAudioDelayList   []string    `json:"link_audio_delay_list"`
+	RangeStep            []RangeStep `json:"range_step"`
+	SceneNum             int         `json:"scene_num"`
+}
+
+// RangeStep describes the accepted values of a numeric setting.
+type RangeStep struct {
+	ID   string  `json:"id"`
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	Step float64 `json:"step"`
+}
+
+// TunerFeatures describes the tuner capabilities.
+type TunerFeatures struct {
+	FuncList  []string    `json:"func_list"`
+	RangeStep []RangeStep `json:"range_step"`
+	Preset    struct {
+		Type string `json:"type"`
+		Num  int    `json:"num"`
+	} `json:"preset"`
+}
+
+// NetUSBFeatures describes the network and USB playback capabilities.
+type NetUSBFeatures struct {
+	FuncList []string `json:"func_list"`
+	Preset   struct {
+		Num int `json:"num"`
+	} `json:"preset"`
+	RecentInfo struct {
+		Num int `json:"num"`
+	} `json:"recent_info"`
+	PlayQueue struct {
+		Size int `json:"size"`
+	} `json:"play_queue"`
+}
+
+// DistributionFeatures describes the multi-room link capabilities.
+type DistributionFeatures struct {
+	Version          float64  `json:"version"`
+	CompatibleClient []int    `json:"compatible_client"`
+	ClientMax        int      `json:"client_max"`
+	ServerZoneList   []string `json:"server_zone_list"`
+}
+
+// ClockFeatures describes the clock and alarm capabilities.
+type ClockFeatures struct {
+	FuncList         []string    `json:"func_list"`
+	RangeStep        []RangeStep `json:"range_step"`
+	AlarmFadeTypeNum int         `json:"alarm_fade_type_num"`
+	AlarmModeList    []string    `json:"alarm_mode_list"`
+	AlarmInputList   []string    `json:"alarm_input_list"`
+	AlarmPresetList  []string    `json:"alarm_preset_list"`
+}
+
+// UnsupportedError is returned by controls the device does not support.
+type UnsupportedError struct {
+	Feature string
+}
+
+// defaultZoneFuncs are assumed for devices not describing their zones.
+var defaultZoneFuncs = []string{"power", "sleep", "volume", "mute"}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s not supported by device", e.Feature)
+}
+
+// GetFeatures returns the device capabilities.
+func (d *Device) GetFeatures() Features {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.features
+}
+
+// Zone returns the capabilities of the zone with the given id.
+func (f Features) Zone(id string) (zf ZoneFeatures, ok bool) {
+	for _, zf = range f.Zones {
+		if zf.ID == id {
+			return zf, true
+		}
+	}
+	return ZoneFeatures{}, false
+}
+
+// Input returns the capabilities of the input with the given id.
+func (f Features) Input(id string) (input InputFeatures, ok bool) {
+	for _, input = range f.System.InputList {
+		if input.ID == id {
+			return input, true
+		}
+	}
+	return InputFeatures{}, false
+}
+
+// HasFunc reports whether the device supports the given system function.
+func (f Features) HasFunc(fn string) bool {
+	return contains(f.System.FuncList, fn)
+}
+
+// HasFunc reports whether the zone supports the given function.
+func (zf ZoneFeatures) HasFunc(fn string) bool {
+	return contains(zf.FuncList, fn)
+}
+
+// Range returns the range of the given zone setting.
+func (zf ZoneFeatures) Range(id string) (RangeStep, bool) {
+	return findRange(zf.RangeStep, id)
+}
+
+// Contains reports whether the given value is within the range.
+func (r RangeStep) Contains(v float64) bool {
+	return v >= r.Min && v <= r.Max
+}
+
+func (d *Device) fetchFeatures() (err error) {
+	resp, err := d.request("GET", "system/getFeatures")
+	if err == nil {
+		var data map[string]interface{}
+		data, err = decodeResponse(resp)
+		if err == nil {
+			var features Features
+			err = updateIn(&features, data)
+			if err == nil {
+				if len(features.Zones) == 0 {
+					features.Zones = []ZoneFeatures{{ID: MainZone, FuncList: defaultZoneFuncs}}
+				}
+				d.features = features
+				zones := make(map[string]Status)
+				for _, zf := range features.Zones {
+					zones[zf.ID] = d.state.Zones[zf.ID]
+				}
+				d.state.Zones = zones
+			}
+		}
+	}
+
+	return err
+}
+
+// requireNetUSB returns an error unless the device supports network and USB playback.
+func (d *Device) requireNetUSB() (err error) {
+	if d.GetFeatures().NetUSB == nil {
+		err = unsupported("netusb")
+	}
+
+	return err
+}
+
+// require returns the zone capabilities or an error unless the zone supports all the given functions.
+func (z *Zone) require(funcs ...string) (zf ZoneFeatures, err error) {
+	zf, ok := z.features()
+	if !ok {
+		return zf, unsupported("zone " + z.id)
+	}
+	for _, fn := range funcs {
+		if !zf.HasFunc(fn) {
+			return zf, unsupported(fmt.Sprintf("%s in zone %s", fn, z.id))
+		}
+	}
+	return zf, nil
+}
+
+// checkRange returns an error unless the value is within the range of the given zone setting.
+func (z *Zone) checkRange(id string, v float64) (err error) {
+	zf, err := z.require()
+	if err == nil {
+		if r, ok := zf.Range(id); ok && !r.Contains(v) {
+			err = fmt.Errorf("invalid %s %v, must be between %v and %v", id, v, r.Min, r.Max)
+		}
+	}
+
+	return err
+}
+
+func unsupported(feature string) error {
+	return &UnsupportedError{feature}
+}
+
+func findRange(ranges []RangeStep, id string) (RangeStep, bool) {
+	for _, r := range ranges {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return RangeStep{}, false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
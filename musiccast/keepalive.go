@@ -0,0 +1,163 @@
+package musiccast
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// SubscriptionTimeout is how long devices keep sending events after the last request.
+const SubscriptionTimeout = 10 * time.Minute
+
+const (
+	DefaultKeepAliveInterval = 5 * time.Minute
+	DefaultResyncAfter       = 15 * time.Minute
+)
+
+// activity tracks the last communication with a device.
+type activity struct {
+	mutex       sync.Mutex
+	lastRequest time.Time
+	lastEvent   time.Time
+	lastSync    time.Time
+	stop        chan struct{}
+}
+
+// LastEvent returns the time the last event was received from the device.
+func (d *Device) LastEvent() time.Time {
+	d.activity.mutex.Lock()
+	defer d.activity.mutex.Unlock()
+	return d.activity.lastEvent
+}
+
+// StartKeepAlive renews the event subscription at least every `interval` and
+// resyncs the device state when no event has been received for `resyncAfter`.
+// Errors are passed to onError, which may be nil. Intervals too short to be
+// used are replaced with DefaultKeepAliveInterval and DefaultResyncAfter.
+func (d *Device) StartKeepAlive(interval, resyncAfter time.Duration, onError func(error)) {
+	if interval/2 <= 0 {
+		interval = DefaultKeepAliveInterval
+	}
+	if resyncAfter <= 0 {
+		resyncAfter = DefaultResyncAfter
+	}
+	stop := make(chan struct{})
+	d.activity.mutex.Lock()
+	if d.activity.stop != nil {
+		close(d.activity.stop)
+	}
+	d.activity.stop = stop
+	d.activity.mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := d.keepAlive(interval/2, resyncAfter); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+// StopKeepAlive stops renewing the event subscription.
+func (d *Device) StopKeepAlive() {
+	d.activity.mutex.Lock()
+	defer d.activity.mutex.Unlock()
+	if d.activity.stop != nil {
+		close(d.activity.stop)
+		d.activity.stop = nil
+	}
+}
+
+func (d *Device) keepAlive(renewAfter, resyncAfter time.Duration) (err error) {
+	d.activity.mutex.Lock()
+	lastRequest := d.activity.lastRequest
+	lastEvent := d.activity.lastEvent
+	if d.activity.lastSync.After(lastEvent) {
+		lastEvent = d.activity.lastSync
+	}
+	d.activity.mutex.Unlock()
+
+	if time.Since(lastEvent) >= resyncAfter {
+		err = d.resync()
+	} else if time.Since(lastRequest) >= renewAfter {
+		err = d.probe()
+	}
+
+	return err
+}
+
+// probe checks whether the device still answers requests.
+func (d *Device) probe() (err error) {
+	resp, err := d.request("GET", "system/getDeviceInfo")
+	if err == nil {
+		_, err = decodeResponse(resp)
+	}
+
+	return err
+}
+
+// resync fetches the whole device state and publishes the changes.
+// The state is left untouched unless it could be fetched entirely.
+func (d *Device) resync() (err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	old, features := d.state.clone(), d.features
+	err = d.sync()
+	if err != nil {
+		d.state, d.features = old, features
+		return err
+	}
+	d.publishDiff(old)
+	return nil
+}
+
+func (d *Device) publishDiff(old state) {
+	if diff := diffState(reflect.ValueOf(old), reflect.ValueOf(d.state)); diff != nil {
+		zones, _ := diff.(event)["zones"].(event)
+		if main, ok := zones[MainZone]; ok {
+			// main zone changes are still published as "status" for consumers predating zones
+			diff.(event)["status"] = main
+		}
+		broker.Pub(diff, d.id)
+		for zone, zoneDiff := range zones {
+			broker.Pub(zoneDiff, zoneTopic(d.id, zone))
+		}
+		if playback := d.state.Playback; trackKey(old.Playback) != trackKey(playback) {
+			d.startArtworkUpdate(playback)
+		}
+		if _, ok := diff.(event)["distribution"]; ok {
+			e := GroupEvent{d.id, d.state.Distribution}
+			if groupID := old.Distribution.GroupID; groupID != "" {
+				broker.Pub(e, groupTopic(groupID))
+			}
+			if groupID := d.state.Distribution.GroupID; groupID != "" && groupID != old.Distribution.GroupID {
+				broker.Pub(e, groupTopic(groupID))
+			}
+		}
+	}
+}
+
+func (a *activity) touchRequest() {
+	a.mutex.Lock()
+	a.lastRequest = time.Now()
+	a.mutex.Unlock()
+}
+
+func (a *activity) touchEvent() {
+	a.mutex.Lock()
+	a.lastEvent = time.Now()
+	a.mutex.Unlock()
+}
+
+func (a *activity) touchSync() {
+	a.mutex.Lock()
+	a.lastSync = time.Now()
+	a.mutex.Unlock()
+}
@@ -0,0 +1,189 @@
+package musiccast
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+)
+
+// DefaultListenAddr is the default address YXC events are received on.
+const DefaultListenAddr = ":41100"
+
+// DefaultAppPort is the port of DefaultListenAddr, announced to devices until a listener is started.
+const DefaultAppPort = 41100
+
+// DefaultBufferSize is large enough for any UDP datagram.
+const DefaultBufferSize = 65536
+
+// Listener receives YXC events and dispatches them to the devices they originate from.
+type Listener struct {
+	// Addr is the UDP address to listen on.
+	Addr string
+	// BufferSize is the size of the receive buffer, events larger than it are dropped.
+	BufferSize int
+	// OnError is called for every socket, decoding and processing error.
+	OnError func(err error)
+	// OnUnknownDevice is called for events from devices that have not been discovered.
+	OnUnknownDevice func(deviceID string, addr *net.UDPAddr)
+	// Registry looks up the devices events originate from, the DefaultRegistry if nil.
+	// Its devices are told to send their events to the listener while it is started.
+	Registry *Registry
+
+	conn    *net.UDPConn
+	done    chan struct{}
+	stopped chan struct{}
+	mutex   sync.Mutex
+}
+
+// NewListener creates a new Listener for the given address.
+func NewListener(addr string) *Listener {
+	return &Listener{Addr: addr, BufferSize: DefaultBufferSize}
+}
+
+// ListenAndDispatch listens and dispatches incoming YXC events on the default address.
+//
+// Deprecated: Use a Listener, which reports errors to the caller instead of logging them.
+func ListenAndDispatch() {
+	l := NewListener(DefaultListenAddr)
+	l.OnError = func(err error) {
+		log.Println(err)
+	}
+	if err := l.Start(); err != nil {
+		log.Println(err)
+	}
+}
+
+// Start binds the listener address and starts dispatching events.
+func (l *Listener) Start() (err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.conn != nil {
+		return fmt.Errorf("listener already started")
+	}
+
+	listenAddr, err := net.ResolveUDPAddr("udp", l.Addr)
+	if err == nil {
+		var conn *net.UDPConn
+		conn, err = net.ListenUDP("udp", listenAddr)
+		if err == nil {
+			l.conn = conn
+			l.done = make(chan struct{})
+			l.stopped = make(chan struct{})
+			l.registry().setAppPort(conn.LocalAddr().(*net.UDPAddr).Port)
+			go l.serve(conn, l.done, l.stopped)
+		}
+	}
+
+	return err
+}
+
+// Stop stops dispatching events and closes the listener socket.
+func (l *Listener) Stop() (err error) {
+	l.mutex.Lock()
+	conn, done, stopped := l.conn, l.done, l.stopped
+	l.conn, l.done, l.stopped = nil, nil, nil
+	l.mutex.Unlock()
+	if conn == nil {
+		return fmt.Errorf("listener not started")
+	}
+
+	close(done)
+	err = conn.Close()
+	<-stopped
+	l.registry().releaseAppPort(conn.LocalAddr().(*net.UDPAddr).Port)
+	return err
+}
+
+// LocalAddr returns the address the listener is bound to, or nil if it is not started.
+func (l *Listener) LocalAddr() *net.UDPAddr {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.conn == nil {
+		return nil
+	}
+	return l.conn.LocalAddr().(*net.UDPAddr)
+}
+
+func (l *Listener) serve(conn *net.UDPConn, done, stopped chan struct{}) {
+	defer close(stopped)
+	size := l.BufferSize
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	buf := make([]byte, size)
+
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-done:
+				return
+			default:
+				l.reportError(err)
+				if ne, ok := err.(net.Error); ok && ne.Temporary() {
+					continue
+				}
+				l.close(conn)
+				return
+			}
+		}
+		l.dispatch(buf[:n], addr)
+	}
+}
+
+func (l *Listener) dispatch(data []byte, addr *net.UDPAddr) {
+	var payload event
+	if err := json.Unmarshal(data, &payload); err != nil {
+		l.reportError(fmt.Errorf("invalid MusicCast event from %s: %v", addr, err))
+		return
+	}
+
+	deviceID, ok := payload["device_id"].(string)
+	if !ok {
+		l.reportError(fmt.Errorf("MusicCast event from %s without device id", addr))
+		return
+	}
+
+	d := l.registry().Get(deviceID)
+	if d == nil {
+		if l.OnUnknownDevice != nil {
+			l.OnUnknownDevice(deviceID, addr)
+		} else {
+			l.reportError(fmt.Errorf("MusicCast event from unknown device %s at %s", deviceID, addr))
+		}
+		return
+	}
+
+	if err := d.processEvent(payload); err != nil {
+		l.reportError(err)
+	}
+}
+
+// close releases the given socket after a read error, so that the listener can be started again.
+func (l *Listener) close(conn *net.UDPConn) {
+	l.mutex.Lock()
+	if l.conn != conn {
+		l.mutex.Unlock()
+		return
+	}
+	l.conn, l.done, l.stopped = nil, nil, nil
+	l.mutex.Unlock()
+
+	conn.Close()
+	l.registry().releaseAppPort(conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+func (l *Listener) registry() *Registry {
+	if l.Registry != nil {
+		return l.Registry
+	}
+	return DefaultRegistry
+}
+
+func (l *Listener) reportError(err error) {
+	if l.OnError != nil {
+		l.OnError(err)
+	}
+}
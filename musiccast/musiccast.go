@@ -1,28 +1,46 @@
 package musiccast
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/cskr/pubsub"
 	upnp "github.com/huin/goupnp"
 	"github.com/huin/goupnp/dcps/av1"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"path"
 	"reflect"
+	"strings"
 	"sync"
+	"unicode"
 )
 
 type event map[string]interface{}
 
 type Status struct {
-	Input     string `json:"input"`
-	Power     string `json:"power"`
-	Sleep     uint8  `json:"sleep"`
-	Volume    uint8  `json:"volume"`
-	Mute      bool   `json:"mute"`
-	MaxVolume uint8  `json:"max_volume"`
+	Input           string       `json:"input"`
+	Power           string       `json:"power"`
+	Sleep           uint8        `json:"sleep"`
+	Volume          uint8        `json:"volume"`
+	Mute            bool         `json:"mute"`
+	MaxVolume       uint8        `json:"max_volume"`
+	ActualVolume    ActualVolume `json:"actual_volume"`
+	SoundProgram    string       `json:"sound_program"`
+	ToneControl     ToneControl  `json:"tone_control"`
+	Equalizer       Equalizer    `json:"equalizer"`
+	Balance         int8         `json:"balance"`
+	DialogueLevel   int8         `json:"dialogue_level"`
+	DialogueLift    int8         `json:"dialogue_lift"`
+	ClearVoice      bool         `json:"clear_voice"`
+	SubwooferVolume int8         `json:"subwoofer_volume"`
+	BassExtension   bool         `json:"bass_extension"`
+	Enhancer        bool         `json:"enhancer"`
+	PureDirect      bool         `json:"pure_direct"`
+	ExtraBass       bool         `json:"extra_bass"`
 }
 
 type Playback struct {
@@ -38,30 +56,69 @@ type Playback struct {
 	Track       string `json:"track"`
 }
 
+// state holds the device state published to subscribers.
+type state struct {
+	Zones        map[string]Status `json:"zones"`
+	Playback     Playback          `json:"playback"`
+	Distribution DistributionInfo  `json:"distribution"`
+	Presets      []Preset          `json:"presets"`
+	RecentItems  []RecentItem      `json:"recent_items"`
+	PlayQueue    PlayQueue         `json:"play_queue"`
+	Tuner        TunerPlayback     `json:"tuner"`
+	TunerPresets []TunerPreset     `json:"tuner_presets"`
+	CD           CDPlayback        `json:"cd"`
+	Bluetooth    BluetoothInfo     `json:"bluetooth"`
+	Clock        ClockSettings     `json:"clock"`
+}
+
+// Device is a MusicCast device. Copies returned by WithContext share the device state.
 type Device struct {
-	id                     string   `json:"id"`
-	model                  string   `json:"model"`
-	name                   string   `json:"name"`
-	status                 Status   `json:"status"`
-	playback               Playback `json:"playback"`
+	*device
+	ctx context.Context
+}
+
+type device struct {
+	id       string
+	model    string
+	name     string
+	state    state
+	endpoint *endpoint
+	client   *client
+	features Features
+	activity *activity
+	browser  *browserList
+	artwork  *artwork
+	mutex    *sync.RWMutex
+	// notification serializes the notifications played on the device.
+	notification sync.Mutex
+}
+
+// endpoint is the network location of a device, which changes when the device gets a new address.
+type endpoint struct {
+	mutex                  sync.RWMutex
 	extendedControlBaseURL url.URL
-	httpClient             *http.Client
+	location               *url.URL
 	avTransport            *av1.AVTransport1
-	mutex                  *sync.RWMutex
 }
 
 var broker = pubsub.New(1)
-var availableDevices = make(map[string]*Device)
 
-// Discover attempts to find MusicCast devices on the local network.
+// DescriptionPort is the port MusicCast devices serve their UPnP description on.
+const DescriptionPort = "49154"
+
+const (
+	extendedControlPath = "YamahaExtendedControl/v1"
+	descriptionPath     = "/MediaRenderer/desc.xml"
+)
+
+// Discover attempts to find MusicCast devices on the local network and adds them to the DefaultRegistry.
 func Discover() (devices []*Device, err error) {
 	maybeRootDevices, err := upnp.DiscoverDevices("urn:schemas-upnp-org:device:MediaRenderer:1")
 	if err == nil {
 		for _, maybeRoot := range maybeRootDevices {
 			d, err := NewDevice(maybeRoot)
 			if err == nil {
-				availableDevices[d.id] = d
-				devices = append(devices, d)
+				devices = append(devices, DefaultRegistry.Add(d))
 			}
 		}
 	}
@@ -69,55 +126,92 @@ func Discover() (devices []*Device, err error) {
 	return devices, err
 }
 
-// ListenAndDispatch listens and dispatches incoming YXC events.
-func ListenAndDispatch() {
-	go func() {
-		listenAddr, err := net.ResolveUDPAddr("udp", ":41100")
-		if err != nil {
-			panic(err)
+// NewDevice creates a new Device from the given UPnP root device.
+//
+// Renderers without presentation URL are reached on the host of their description.
+func NewDevice(maybeRoot upnp.MaybeRootDevice) (device *Device, err error) {
+	err = maybeRoot.Err
+	if err == nil {
+		extendedControlURL := maybeRoot.Root.Device.PresentationURL.URL
+		if extendedControlURL.Host == "" {
+			extendedControlURL = url.URL{Scheme: "http", Host: urlHost(maybeRoot.Location.Hostname()), Path: "/"}
 		}
+		extendedControlURL.Path = path.Join(extendedControlURL.Path, extendedControlPath)
+		device, err = newDevice(extendedControlURL, maybeRoot.Root, maybeRoot.Location)
+	}
 
-		conn, err := net.ListenUDP("udp", listenAddr)
-		if err != nil {
-			panic(err)
-		}
+	return device, err
+}
 
-		buf := make([]byte, 1024)
-		defer conn.Close()
+// NewDeviceFromHost creates a new Device from its host name or address, without UPnP discovery.
+//
+// The host may include a port, in which case both the extended control API and the UPnP
+// description are requested on that port instead of the default ones.
+func NewDeviceFromHost(host string) (device *Device, err error) {
+	extendedControlURL, location := hostURLs(host)
+	root, err := upnp.DeviceByURL(location)
+	if err == nil {
+		device, err = newDevice(extendedControlURL, root, location)
+	}
 
-		for {
-			size, _, err := conn.ReadFromUDP(buf)
-			if err != nil {
-				panic(err)
-			}
-			var payload event
-			err = json.Unmarshal(buf[0:size], &payload)
-			if err != nil {
-				panic(err)
-			}
-			d := availableDevices[payload["device_id"].(string)]
-			err = d.processEvent(payload)
-			if err != nil {
-				panic(err)
-			}
+	return device, err
+}
+
+// hostURLs returns the extended control base URL and the description location of the given host.
+func hostURLs(host string) (extendedControlURL url.URL, location *url.URL) {
+	descriptionHost := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = urlHost(strings.Trim(host, "[]"))
+		descriptionHost = net.JoinHostPort(strings.Trim(host, "[]"), DescriptionPort)
+	}
+	extendedControlURL = url.URL{Scheme: "http", Host: host, Path: "/" + extendedControlPath}
+	location = &url.URL{Scheme: "http", Host: descriptionHost, Path: descriptionPath}
+	return extendedControlURL, location
+}
+
+// urlHost returns the given host name or address as used in URLs, with IPv6 addresses in brackets.
+func urlHost(host string) string {
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+// LoadDevices creates the devices with the given host names or addresses and adds them to the
+// DefaultRegistry, as an alternative to Discover on networks where multicast is blocked.
+// Devices failing to load are skipped and the last error is returned.
+func LoadDevices(hosts []string) (devices []*Device, err error) {
+	for _, host := range hosts {
+		d, e := NewDeviceFromHost(host)
+		if e != nil {
+			err = fmt.Errorf("%s: %v", host, e)
+			continue
 		}
-	}()
+		devices = append(devices, DefaultRegistry.Add(d))
+	}
+
+	return devices, err
 }
 
-// NewDevice creates a new Device from the given UPnP root device.
-func NewDevice(maybeRoot upnp.MaybeRootDevice) (device *Device, err error) {
-	err = maybeRoot.Err
+// ParseHosts splits a comma or space separated list of hosts, with optional ports, as found in configuration.
+func ParseHosts(list string) []string {
+	return strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+func newDevice(extendedControlURL url.URL, root *upnp.RootDevice, location *url.URL) (d *Device, err error) {
+	avTransportClients, err := av1.NewAVTransport1ClientsFromRootDevice(root, location)
 	if err == nil {
-		extendedControlURL := maybeRoot.Root.Device.PresentationURL.URL
-		extendedControlURL.Path = path.Join(extendedControlURL.Path, "YamahaExtendedControl", "v1")
-		avTransportClients, err := av1.NewAVTransport1ClientsFromRootDevice(maybeRoot.Root, maybeRoot.Location)
-		if err == nil {
-			device = &Device{"", "", "", Status{}, Playback{}, extendedControlURL, &http.Client{}, avTransportClients[0], &sync.RWMutex{}}
-			err = device.sync()
+		if len(avTransportClients) == 0 {
+			return nil, fmt.Errorf("no AVTransport service at %s", location)
 		}
+		ep := &endpoint{extendedControlBaseURL: extendedControlURL, location: location, avTransport: avTransportClients[0]}
+		d = &Device{device: &device{endpoint: ep, client: newClient(), mutex: &sync.RWMutex{}, activity: &activity{}, browser: &browserList{}, artwork: &artwork{}}}
+		err = d.sync()
 	}
 
-	return device, err
+	return d, err
 }
 
 // GetDeviceID returns the device id.
@@ -141,18 +235,16 @@ func (d *Device) GetNetworkName() string {
 	return d.name
 }
 
-// GetStatus returns the device status state.
+// GetStatus returns the main zone status state.
 func (d *Device) GetStatus() Status {
-	d.mutex.RLock()
-	defer d.mutex.RUnlock()
-	return d.status
+	return d.zone(MainZone).GetStatus()
 }
 
 // GetPlayback returns the device playback state.
 func (d *Device) GetPlayback() Playback {
 	d.mutex.RLock()
 	defer d.mutex.RUnlock()
-	return d.playback
+	return d.state.Playback
 }
 
 // Play begins playback of the current track.
@@ -180,48 +272,39 @@ func (d *Device) Previous() (err error) {
 	return d.setPlayback("previous")
 }
 
-// SetVolume sets the volume to the given value.
+// SetVolume sets the main zone volume to the given value.
 func (d *Device) SetVolume(volume uint8) (err error) {
-	params := map[string]interface{}{"volume": volume}
-	resp, err := d.requestWithParams("GET", "main/setVolume", params)
-	if err == nil {
-		_, err = decodeResponse(resp)
-	}
-
-	return err
+	return d.zone(MainZone).SetVolume(volume)
 }
 
-// IncreaseVolume increases the volume by the given value.
+// IncreaseVolume increases the main zone volume by the given value.
 func (d *Device) IncreaseVolume(step uint8) (err error) {
-	params := map[string]interface{}{"volume": "up", "step": step}
-	resp, err := d.requestWithParams("GET", "main/setVolume", params)
-	if err == nil {
-		_, err = decodeResponse(resp)
-	}
-
-	return err
+	return d.zone(MainZone).IncreaseVolume(step)
 }
 
-// DecreaseVolume decreases the volume by the given value.
+// DecreaseVolume decreases the main zone volume by the given value.
 func (d *Device) DecreaseVolume(step uint8) (err error) {
-	params := map[string]interface{}{"volume": "down", "step": step}
-	resp, err := d.requestWithParams("GET", "main/setVolume", params)
-	if err == nil {
-		_, err = decodeResponse(resp)
-	}
-
-	return err
+	return d.zone(MainZone).DecreaseVolume(step)
 }
 
-// SetMute mutes and unmutes the volume.
+// SetMute mutes and unmutes the main zone volume.
 func (d *Device) SetMute(mute bool) (err error) {
-	params := map[string]interface{}{"enable": mute}
-	resp, err := d.requestWithParams("GET", "main/setMute", params)
-	if err == nil {
-		_, err = decodeResponse(resp)
-	}
+	return d.zone(MainZone).SetMute(mute)
+}
 
-	return err
+// SetPower sets the main zone power to "on", "standby" or "toggle".
+func (d *Device) SetPower(power string) (err error) {
+	return d.zone(MainZone).SetPower(power)
+}
+
+// SetInput selects the main zone input.
+func (d *Device) SetInput(input string) (err error) {
+	return d.zone(MainZone).SetInput(input)
+}
+
+// SetSoundProgram selects the main zone sound program.
+func (d *Device) SetSoundProgram(program string) (err error) {
+	return d.zone(MainZone).SetSoundProgram(program)
 }
 
 // Subscribe returns a channel for receiving update notifications from the device.
@@ -232,23 +315,33 @@ func (d *Device) Subscribe() chan interface{} {
 func (d *Device) MarshalJSON() ([]byte, error) {
 	d.mutex.RLock()
 	defer d.mutex.RUnlock()
-	// we should do this dynamically
 	return json.Marshal(&struct {
-		ID       string   `json:"id"`
-		Model    string   `json:"model"`
-		name     string   `json:"name"`
-		Status   Status   `json:"status"`
-		Playback Playback `json:"playback"`
-	}{d.id, d.model, d.name, d.status, d.playback})
+		ID     string `json:"id"`
+		Model  string `json:"model"`
+		Name   string `json:"name"`
+		Status Status `json:"status"`
+		state
+	}{d.id, d.model, d.name, d.state.Zones[MainZone], d.state})
 }
 
 func (d *Device) fetchDeviceInfo() (err error) {
 	resp, err := d.request("GET", "system/getDeviceInfo")
 	if err == nil {
-		data, err := decodeResponse(resp)
+		var data map[string]interface{}
+		data, err = decodeResponse(resp)
 		if err == nil {
-			d.id = data["device_id"].(string)
-			d.model = data["model_name"].(string)
+			var info struct {
+				DeviceID  string `json:"device_id"`
+				ModelName string `json:"model_name"`
+			}
+			err = updateIn(&info, data)
+			if err == nil && info.DeviceID == "" {
+				err = fmt.Errorf("invalid extended control response from system/getDeviceInfo: missing device id")
+			}
+			if err == nil {
+				d.id = info.DeviceID
+				d.model = info.ModelName
+			}
 		}
 	}
 
@@ -258,20 +351,34 @@ func (d *Device) fetchDeviceInfo() (err error) {
 func (d *Device) fetchNetworkStatus() (err error) {
 	resp, err := d.request("GET", "system/getNetworkStatus")
 	if err == nil {
-		data, err := decodeResponse(resp)
+		var data map[string]interface{}
+		data, err = decodeResponse(resp)
 		if err == nil {
-			d.name = data["network_name"].(string)
+			var status struct {
+				NetworkName string `json:"network_name"`
+			}
+			err = updateIn(&status, data)
+			if err == nil {
+				d.name = status.NetworkName
+			}
 		}
 	}
 
 	return err
 }
 
-func (d *Device) fetchStatus() (err error) {
-	resp, err := d.request("GET", "main/getStatus")
+func (d *Device) fetchStatus(zone string) (err error) {
+	resp, err := d.request("GET", path.Join(zone, "getStatus"))
 	if err == nil {
-		defer resp.Body.Close()
-		err = json.NewDecoder(resp.Body).Decode(&d.status)
+		var data map[string]interface{}
+		data, err = decodeResponse(resp)
+		if err == nil {
+			var status Status
+			err = updateIn(&status, data)
+			if err == nil {
+				d.state.Zones[zone] = status
+			}
+		}
 	}
 
 	return err
@@ -280,8 +387,30 @@ func (d *Device) fetchStatus() (err error) {
 func (d *Device) fetchPlayback() (err error) {
 	resp, err := d.request("GET", "netusb/getPlayInfo")
 	if err == nil {
-		defer resp.Body.Close()
-		err = json.NewDecoder(resp.Body).Decode(&d.playback)
+		var data map[string]interface{}
+		data, err = decodeResponse(resp)
+		if err == nil {
+			var playback Playback
+			err = updateIn(&playback, data)
+			if err == nil {
+				d.state.Playback = playback
+			}
+		}
+	}
+
+	return err
+}
+
+func (d *Device) syncNetUSB() (err error) {
+	err = d.fetchPlayback()
+	if err == nil {
+		err = d.fetchPresets()
+	}
+	if err == nil && contains(d.features.NetUSB.FuncList, "recent_info") {
+		err = d.fetchRecentItems()
+	}
+	if err == nil && contains(d.features.NetUSB.FuncList, "play_queue") {
+		err = d.fetchPlayQueue()
 	}
 
 	return err
@@ -292,9 +421,35 @@ func (d *Device) sync() (err error) {
 	if err == nil {
 		err = d.fetchNetworkStatus()
 		if err == nil {
-			err = d.fetchStatus()
+			err = d.fetchFeatures()
+			for zone := range d.state.Zones {
+				if err == nil {
+					err = d.fetchStatus(zone)
+				}
+			}
+			if err == nil && d.features.NetUSB != nil {
+				err = d.syncNetUSB()
+			}
+			if err == nil && d.features.Tuner != nil {
+				err = d.fetchTunerPlayback()
+				if err == nil {
+					err = d.fetchTunerPresets()
+				}
+			}
+			if _, ok := d.features.Input(InputCD); ok && err == nil {
+				err = d.fetchCDPlayback()
+			}
+			if err == nil && d.features.supportsBluetooth() {
+				err = d.fetchBluetoothInfo()
+			}
+			if err == nil && d.features.Distribution != nil {
+				err = d.fetchDistributionInfo()
+			}
+			if err == nil && d.features.Clock != nil {
+				err = d.fetchClockSettings()
+			}
 			if err == nil {
-				err = d.fetchPlayback()
+				d.activity.touchSync()
 			}
 		}
 	}
@@ -304,25 +459,21 @@ func (d *Device) sync() (err error) {
 
 func (d *Device) processEvent(e event) (err error) {
 	if d.id != e["device_id"] {
-		panic(fmt.Errorf("unmatched device id"))
+		return fmt.Errorf("unmatched device id %v", e["device_id"])
 	} else {
 		delete(e, "device_id")
 	}
 
+	d.activity.touchEvent()
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
-	old := *d
-	if main, ok := e["main"].(map[string]interface{}); ok {
-		if main["status_updated"] == true {
-			err = d.fetchStatus()
-			delete(main, "status_updated")
-		}
-		if main["signal_info_updated"] == true {
-			delete(main, "signal_info_updated")
+	old := d.state.clone()
+	for zone := range d.state.Zones {
+		if fragment, ok := e[zone].(map[string]interface{}); ok {
+			err = d.processZoneEvent(zone, fragment)
+			delete(e, zone)
 		}
-		err = updateIn(&d.status, main)
-		delete(e, "main")
 	}
 
 	if netusb, ok := e["netusb"].(map[string]interface{}); ok {
@@ -330,23 +481,84 @@ func (d *Device) processEvent(e event) (err error) {
 			err = d.fetchPlayback()
 			delete(netusb, "play_info_updated")
 		}
+		if netusb["preset_info_updated"] == true {
+			err = d.fetchPresets()
+			delete(netusb, "preset_info_updated")
+		}
 		if netusb["recent_updated"] == true {
+			err = d.fetchRecentItems()
 			delete(netusb, "recent_updated")
 		}
 		if playQueue, ok := netusb["play_queue"].(map[string]interface{}); ok {
 			if playQueue["updated"] == true {
+				err = d.fetchPlayQueue()
 				delete(playQueue, "updated")
 			}
 			delete(netusb, "play_queue")
 		}
-		err = updateIn(&d.playback, netusb)
+		if netusb["list_info_updated"] == true {
+			err = d.Browser().refresh()
+			delete(netusb, "list_info_updated")
+		}
+		err = updateIn(&d.state.Playback, netusb)
 		delete(e, "netusb")
 	}
 
-	if diff := diffState(reflect.ValueOf(old), reflect.ValueOf(*d)); diff != nil {
-		broker.Pub(diff, d.id)
+	if tuner, ok := e["tuner"].(map[string]interface{}); ok {
+		if tuner["play_info_updated"] == true {
+			err = d.fetchTunerPlayback()
+			delete(tuner, "play_info_updated")
+		}
+		if tuner["preset_info_updated"] == true {
+			err = d.fetchTunerPresets()
+			delete(tuner, "preset_info_updated")
+		}
+		if len(tuner) == 0 {
+			delete(e, "tuner")
+		}
+	}
+
+	if cd, ok := e["cd"].(map[string]interface{}); ok {
+		if cd["play_info_updated"] == true {
+			err = d.fetchCDPlayback()
+			delete(cd, "play_info_updated")
+		}
+		err = updateIn(&d.state.CD, cd)
+		delete(e, "cd")
+	}
+
+	if system, ok := e["system"].(map[string]interface{}); ok {
+		if system["bluetooth_info_updated"] == true {
+			err = d.fetchBluetoothInfo()
+			delete(system, "bluetooth_info_updated")
+		}
+		if len(system) == 0 {
+			delete(e, "system")
+		}
+	}
+
+	if dist, ok := e["dist"].(map[string]interface{}); ok {
+		if dist["dist_info_updated"] == true {
+			err = d.fetchDistributionInfo()
+			delete(dist, "dist_info_updated")
+		}
+		if len(dist) == 0 {
+			delete(e, "dist")
+		}
 	}
 
+	if clock, ok := e["clock"].(map[string]interface{}); ok {
+		if clock["settings_updated"] == true {
+			err = d.fetchClockSettings()
+			delete(clock, "settings_updated")
+		}
+		if len(clock) == 0 {
+			delete(e, "clock")
+		}
+	}
+
+	d.publishDiff(old)
+
 	if len(e) > 0 {
 		err = fmt.Errorf("unhandled fragment in MusicCast event %v", e)
 	}
@@ -354,11 +566,28 @@ func (d *Device) processEvent(e event) (err error) {
 	return err
 }
 
+func (d *Device) processZoneEvent(zone string, fragment map[string]interface{}) (err error) {
+	if fragment["status_updated"] == true {
+		err = d.fetchStatus(zone)
+		delete(fragment, "status_updated")
+	}
+	if fragment["signal_info_updated"] == true {
+		delete(fragment, "signal_info_updated")
+	}
+	status := d.state.Zones[zone]
+	err = updateIn(&status, fragment)
+	d.state.Zones[zone] = status
+	return err
+}
+
 func (d *Device) setPlayback(playback string) (err error) {
-	params := map[string]interface{}{"playback": playback}
-	resp, err := d.requestWithParams("GET", "netusb/setPlayback", params)
-	if err == nil {
-		_, err = decodeResponse(resp)
+	if err = d.requireNetUSB(); err == nil {
+		params := map[string]interface{}{"playback": playback}
+		var resp *http.Response
+		resp, err = d.requestWithParams("GET", "netusb/setPlayback", params)
+		if err == nil {
+			_, err = decodeResponse(resp)
+		}
 	}
 
 	return err
@@ -369,13 +598,8 @@ func (d *Device) request(m string, p string) (resp *http.Response, err error) {
 }
 
 func (d *Device) requestWithParams(m string, p string, q map[string]interface{}) (resp *http.Response, err error) {
-	url := d.extendedControlBaseURL
-	url.Path = path.Join(url.Path, p)
-
-	req, err := http.NewRequest(m, url.String(), nil)
+	req, err := d.newRequest(m, p, nil)
 	if err == nil {
-		req.Header.Add("X-AppName", "MusicCast/1.50")
-		req.Header.Add("X-AppPort", "41100")
 		if len(q) > 0 {
 			params := req.URL.Query()
 			for k, v := range q {
@@ -383,25 +607,112 @@ func (d *Device) requestWithParams(m string, p string, q map[string]interface{})
 			}
 			req.URL.RawQuery = params.Encode()
 		}
-		resp, err = d.httpClient.Do(req)
+		resp, err = d.do(req)
 	}
 
 	return resp, err
 }
 
+func (d *Device) requestWithBody(m string, p string, body interface{}) (resp *http.Response, err error) {
+	data, err := json.Marshal(body)
+	if err == nil {
+		var req *http.Request
+		req, err = d.newRequest(m, p, bytes.NewReader(data))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+			resp, err = d.do(req)
+		}
+	}
+
+	return resp, err
+}
+
+func (d *Device) newRequest(m string, p string, body io.Reader) (req *http.Request, err error) {
+	url := d.baseURL()
+	url.Path = path.Join(url.Path, p)
+
+	return d.newURLRequest(m, url.String(), body)
+}
+
+// newURLRequest creates a request to the given URL of the device, announcing the app
+// and the port its events are sent to like the MusicCast app.
+func (d *Device) newURLRequest(m string, u string, body io.Reader) (req *http.Request, err error) {
+	req, err = http.NewRequest(m, u, body)
+	if err == nil {
+		req.Header.Add("X-AppName", "MusicCast/1.50")
+		if port := d.appPort(); port != 0 {
+			req.Header.Add("X-AppPort", fmt.Sprint(port))
+		}
+	}
+
+	return req, err
+}
+
+// host returns the host name or IP address of the device.
+func (d *Device) host() string {
+	u := d.baseURL()
+	return u.Hostname()
+}
+
+// location returns the URL of the UPnP description of the device.
+func (d *Device) location() *url.URL {
+	d.endpoint.mutex.RLock()
+	defer d.endpoint.mutex.RUnlock()
+	return d.endpoint.location
+}
+
+func (d *Device) baseURL() url.URL {
+	d.endpoint.mutex.RLock()
+	defer d.endpoint.mutex.RUnlock()
+	return d.endpoint.extendedControlBaseURL
+}
+
+// transport returns the AVTransport client of the device, sending its requests
+// with the device HTTP client, context and timeout.
+func (d *Device) transport() *av1.AVTransport1 {
+	d.endpoint.mutex.RLock()
+	avTransport := d.endpoint.avTransport
+	d.endpoint.mutex.RUnlock()
+	if avTransport == nil {
+		return nil
+	}
+
+	c := *avTransport
+	soapClient := *avTransport.SOAPClient
+	soapClient.HTTPClient = http.Client{Transport: soapTransport{d}}
+	c.SOAPClient = &soapClient
+	return &c
+}
+
 func decodeResponse(resp *http.Response) (data map[string]interface{}, err error) {
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{responsePath(resp), resp.StatusCode}
+	}
 	err = json.NewDecoder(resp.Body).Decode(&data)
 	if err == nil {
-		resp_code := data["response_code"].(float64)
+		code, ok := data["response_code"].(float64)
+		if !ok {
+			return data, fmt.Errorf("invalid extended control response from %s: missing response code", responsePath(resp))
+		}
 		delete(data, "response_code")
-		if resp_code != 0 {
-			err = fmt.Errorf("extended control error %d", resp_code)
+		if code != ResponseOK {
+			err = &ResponseError{responsePath(resp), int(code)}
 		}
 	}
 	return data, err
 }
 
+// clone copies the state. Slices are shared, fetches must assign new ones instead of updating them in place.
+func (s state) clone() state {
+	c := s
+	c.Zones = make(map[string]Status, len(s.Zones))
+	for k, v := range s.Zones {
+		c.Zones[k] = v
+	}
+	return c
+}
+
 func diffState(av, bv reflect.Value) interface{} {
 	at := av.Type()
 	switch kind := at.Kind(); kind {
@@ -435,6 +746,24 @@ func diffState(av, bv reflect.Value) interface{} {
 		}
 	case reflect.Ptr:
 		break
+	case reflect.Slice:
+		if !reflect.DeepEqual(av.Interface(), bv.Interface()) {
+			return bv.Interface()
+		}
+	case reflect.Map:
+		d := make(event)
+		for _, k := range bv.MapKeys() {
+			a := av.MapIndex(k)
+			if !a.IsValid() {
+				a = reflect.Zero(bv.Type().Elem())
+			}
+			if v := diffState(a, bv.MapIndex(k)); v != nil {
+				d[fmt.Sprint(k.Interface())] = v
+			}
+		}
+		if len(d) > 0 {
+			return d
+		}
 	case reflect.Struct:
 		d := make(event)
 		for i := 0; i < av.NumField(); i++ {
@@ -456,7 +785,8 @@ func diffState(av, bv reflect.Value) interface{} {
 
 func updateIn(field interface{}, update map[string]interface{}) (err error) {
 	if len(update) > 0 {
-		data, err := json.Marshal(update)
+		var data []byte
+		data, err = json.Marshal(update)
 		if err == nil {
 			err = json.Unmarshal(data, field)
 		}
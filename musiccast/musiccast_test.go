@@ -0,0 +1,1439 @@
+package musiccast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/almightycouch/couchpotatoe/musiccast/musiccasttest"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestDevice(t *testing.T) (*musiccasttest.Server, *Device) {
+	t.Helper()
+	s := musiccasttest.NewServer()
+	t.Cleanup(s.Close)
+	d, err := NewDevice(s.Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, d
+}
+
+// subscribe subscribes to the given topic until the end of the test.
+func subscribe(t *testing.T, ch chan interface{}) chan interface{} {
+	t.Cleanup(func() {
+		go func() {
+			for range ch {
+			}
+		}()
+		broker.Unsub(ch)
+	})
+	return ch
+}
+
+// subscribeRegistry subscribes to the events of the given registry until the end of the test.
+func subscribeRegistry(t *testing.T, r *Registry) chan interface{} {
+	ch := r.Subscribe()
+	t.Cleanup(func() {
+		go func() {
+			for range ch {
+			}
+		}()
+		r.events.Unsub(ch)
+	})
+	return ch
+}
+
+func receive(t *testing.T, ch chan interface{}) interface{} {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for update")
+		return nil
+	}
+}
+
+func TestNewDevice(t *testing.T) {
+	_, d := newTestDevice(t)
+
+	if id := d.GetDeviceID(); id != musiccasttest.DeviceID {
+		t.Errorf("device id = %q, want %q", id, musiccasttest.DeviceID)
+	}
+	if model := d.GetDeviceModel(); model != musiccasttest.ModelName {
+		t.Errorf("model = %q, want %q", model, musiccasttest.ModelName)
+	}
+	if name := d.GetNetworkName(); name != musiccasttest.NetworkName {
+		t.Errorf("network name = %q, want %q", name, musiccasttest.NetworkName)
+	}
+	if zones := d.Zones(); len(zones) != 1 || zones[0].GetZoneID() != MainZone {
+		t.Errorf("zones = %v, want only %s", zones, MainZone)
+	}
+	want := Status{Input: "net_radio", Power: PowerStandby, Volume: 20, MaxVolume: musiccasttest.MaxVolume, SoundProgram: "stereo",
+		ActualVolume: ActualVolume{VolumeModeDB, -70.5, "dB"}}
+	if status := d.GetStatus(); !reflect.DeepEqual(status, want) {
+		t.Errorf("status = %+v, want %+v", status, want)
+	}
+	if playback := d.GetPlayback(); playback.Playback != "stop" {
+		t.Errorf("playback = %q, want stop", playback.Playback)
+	}
+}
+
+func TestDeviceControls(t *testing.T) {
+	s, d := newTestDevice(t)
+	zone := d.Zone(MainZone)
+
+	if err := d.SetPower(PowerOn); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetVolume(35); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetMute(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetInput("spotify"); err != nil {
+		t.Fatal(err)
+	}
+	if err := zone.SetBalance(-3); err != nil {
+		t.Fatal(err)
+	}
+	if err := zone.SetExtraBass(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Play(); err != nil {
+		t.Fatal(err)
+	}
+
+	status := s.Status(MainZone)
+	for k, want := range map[string]interface{}{"power": "on", "volume": 35, "mute": true, "input": "spotify", "balance": -3, "extra_bass": true} {
+		if status[k] != want {
+			t.Errorf("%s = %v, want %v", k, status[k], want)
+		}
+	}
+	if playback := s.Playback()["playback"]; playback != "play" {
+		t.Errorf("playback = %v, want play", playback)
+	}
+}
+
+func TestDeviceControlsValidation(t *testing.T) {
+	s, d := newTestDevice(t)
+	zone := d.Zone(MainZone)
+
+	if err := d.SetVolume(musiccasttest.MaxVolume + 1); err == nil {
+		t.Error("expected error for volume out of range")
+	}
+	if err := zone.SetBalance(13); err == nil {
+		t.Error("expected error for balance out of range")
+	}
+	if err := d.SetPower("off"); err == nil {
+		t.Error("expected error for invalid power")
+	}
+	if err := d.SetInput("hdmi1"); err == nil {
+		t.Errorf("expected error for unsupported input")
+	} else if _, ok := err.(*UnsupportedError); !ok {
+		t.Errorf("error = %T, want *UnsupportedError", err)
+	}
+	if err := zone.SetEnhancer(true); err == nil {
+		t.Error("expected error for unsupported enhancer")
+	}
+	if volume := s.Status(MainZone)["volume"]; volume != 20 {
+		t.Errorf("volume = %v, want unchanged 20", volume)
+	}
+}
+
+func TestDecodeResponse(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		body   string
+		err    error
+	}{
+		{http.StatusOK, `{"response_code": 0, "volume": 20}`, nil},
+		{http.StatusOK, `{"response_code": 4}`, &ResponseError{"main/setVolume", ResponseInvalidParameter}},
+		{http.StatusOK, `{"response_code": 107}`, &ResponseError{"main/setVolume", ResponseServerMaintenance}},
+		{http.StatusInternalServerError, `{"response_code": 0}`, &StatusError{"main/setVolume", http.StatusInternalServerError}},
+	} {
+		req, _ := http.NewRequest("GET", "http://127.0.0.1/YamahaExtendedControl/v1/main/setVolume", nil)
+		resp := &http.Response{StatusCode: tc.status, Body: ioutil.NopCloser(strings.NewReader(tc.body)), Request: req}
+		if _, err := decodeResponse(resp); !reflect.DeepEqual(err, tc.err) {
+			t.Errorf("decodeResponse(%d %s) error = %v, want %v", tc.status, tc.body, err, tc.err)
+		}
+	}
+
+	for _, body := range []string{`{}`, `{"response_code": "0"}`, `[]`} {
+		resp := &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(body))}
+		if _, err := decodeResponse(resp); err == nil {
+			t.Errorf("decodeResponse(%s) expected error", body)
+		}
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	_, d := newTestDevice(t)
+
+	err := d.zone(MainZone).call("setNothing", nil)
+	if e, ok := err.(*ResponseError); !ok || e.Code != ResponseInvalidRequest || e.Path != "main/setNothing" {
+		t.Fatalf("error = %#v, want invalid request on main/setNothing", err)
+	}
+	if (&ResponseError{Code: ResponseFirmwareUpdating}).Temporary() != true {
+		t.Error("firmware updating should be temporary")
+	}
+	if (&ResponseError{Code: ResponseInvalidParameter}).Temporary() != false {
+		t.Error("invalid parameter should not be temporary")
+	}
+}
+
+func TestProcessEvent(t *testing.T) {
+	s, d := newTestDevice(t)
+	zoneUpdates := subscribe(t, d.Zone(MainZone).Subscribe())
+	updates := subscribe(t, d.Subscribe())
+
+	err := d.processEvent(event{"device_id": musiccasttest.DeviceID, "main": map[string]interface{}{"volume": 42.0, "mute": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := event{"volume": uint64(42), "mute": true}
+	if diff := receive(t, updates); !reflect.DeepEqual(diff, event{"zones": event{MainZone: want}, "status": want}) {
+		t.Errorf("device diff = %v", diff)
+	}
+	if diff := receive(t, zoneUpdates); !reflect.DeepEqual(diff, want) {
+		t.Errorf("zone diff = %v, want %v", diff, want)
+	}
+	if status := d.GetStatus(); status.Volume != 42 || !status.Mute {
+		t.Errorf("status = %+v, want volume 42 and muted", status)
+	}
+
+	s.SetPlayback("artist", "Nils Frahm")
+	err = d.processEvent(event{"device_id": musiccasttest.DeviceID, "netusb": map[string]interface{}{"play_info_updated": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := receive(t, updates); !reflect.DeepEqual(diff, event{"playback": event{"artist": "Nils Frahm"}}) {
+		t.Errorf("device diff = %v", diff)
+	}
+
+	if err := d.processEvent(event{"device_id": "unknown"}); err == nil {
+		t.Error("expected error for unmatched device id")
+	}
+	if err := d.processEvent(event{"device_id": musiccasttest.DeviceID, "zone9": map[string]interface{}{}}); err == nil {
+		t.Error("expected error for unhandled fragment")
+	}
+}
+
+func TestDiffState(t *testing.T) {
+	a := state{Zones: map[string]Status{MainZone: {Volume: 10, Input: "aux"}}}
+	b := a.clone()
+	if diff := diffState(reflect.ValueOf(a), reflect.ValueOf(b)); diff != nil {
+		t.Errorf("diff of equal states = %v, want nil", diff)
+	}
+
+	b.Zones[MainZone] = Status{Volume: 12, Input: "aux", ToneControl: ToneControl{Bass: -2}}
+	b.Zones[Zone2] = Status{Power: PowerOn}
+	b.Presets = []Preset{{Input: "net_radio", Text: "FM4"}}
+	want := event{
+		"zones": event{
+			MainZone: event{"volume": uint64(12), "tone_control": event{"bass": int64(-2)}},
+			Zone2:    event{"power": PowerOn},
+		},
+		"presets": b.Presets,
+	}
+	if diff := diffState(reflect.ValueOf(a), reflect.ValueOf(b)); !reflect.DeepEqual(diff, want) {
+		t.Errorf("diff = %v, want %v", diff, want)
+	}
+}
+
+func TestListener(t *testing.T) {
+	s, d := newTestDevice(t)
+	registry := NewRegistry()
+	registry.Add(d)
+
+	l := NewListener("127.0.0.1:0")
+	l.Registry = registry
+	errs := make(chan error, 1)
+	l.OnError = func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	if err := l.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Stop()
+
+	updates := subscribe(t, d.Zone(MainZone).Subscribe())
+	if err := d.SetVolume(35); err != nil {
+		t.Fatal(err)
+	}
+	if diff := receive(t, updates); !reflect.DeepEqual(diff, event{"volume": uint64(35), "actual_volume": event{"value": -63.0}}) {
+		t.Errorf("diff = %v, want volume 35", diff)
+	}
+
+	s.SetStatus(MainZone, "power", PowerOn)
+	if diff := receive(t, updates); !reflect.DeepEqual(diff, event{"power": PowerOn}) {
+		t.Errorf("diff = %v, want power on", diff)
+	}
+
+	select {
+	case err := <-errs:
+		t.Error(err)
+	default:
+	}
+}
+
+func TestListenerAppPort(t *testing.T) {
+	_, d := newTestDevice(t)
+	registry := NewRegistry()
+	registry.Add(d)
+	other := NewListener("127.0.0.1:0")
+	other.Registry = NewRegistry()
+	if err := other.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Stop()
+
+	l := NewListener("127.0.0.1:0")
+	l.Registry = registry
+	for i := 0; i < 2; i++ {
+		if err := l.Start(); err != nil {
+			t.Fatal(err)
+		}
+		if port := d.appPort(); port != l.LocalAddr().Port {
+			t.Errorf("app port = %d, want %d", port, l.LocalAddr().Port)
+		}
+		if err := l.Stop(); err != nil {
+			t.Fatal(err)
+		}
+		if port := d.appPort(); port != 0 {
+			t.Errorf("app port = %d after stop, want 0", port)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	s, d := newTestDevice(t)
+	registry := NewRegistry()
+	events := registry.Subscribe()
+	defer func() {
+		go func() {
+			for range events {
+			}
+		}()
+		registry.events.Unsub(events)
+	}()
+
+	registry.Add(d)
+	if e := receive(t, events); e != (RegistryEvent{DeviceAdded, d}) {
+		t.Errorf("event = %v, want device added", e)
+	}
+	if got := registry.Get(musiccasttest.DeviceID); got != d {
+		t.Errorf("Get = %v, want %v", got, d)
+	}
+	registry.Add(d)
+	if devices := registry.Devices(); len(devices) != 1 {
+		t.Errorf("devices = %v, want one device", devices)
+	}
+
+	// the same device reached by host name keeps its address
+	same, err := NewDevice(s.Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	same.endpoint.extendedControlBaseURL.Host = strings.Replace(same.endpoint.extendedControlBaseURL.Host, "127.0.0.1", "localhost", 1)
+	location := *same.endpoint.location
+	location.Host = strings.Replace(location.Host, "127.0.0.1", "localhost", 1)
+	same.endpoint.location = &location
+	if got := registry.Add(same); got != d {
+		t.Errorf("Add = %v, want registered device %v", got, d)
+	}
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event %v", e)
+	default:
+	}
+
+	registry.Remove(musiccasttest.DeviceID)
+	if e := receive(t, events); e != (RegistryEvent{DeviceRemoved, d}) {
+		t.Errorf("event = %v, want device removed", e)
+	}
+	if got := registry.Get(musiccasttest.DeviceID); got != nil {
+		t.Errorf("Get = %v, want nil", got)
+	}
+}
+
+func TestRegistryRelocate(t *testing.T) {
+	s1, d := newTestDevice(t)
+	s2, moved := newTestDevice(t)
+	registry := NewRegistry()
+	events := subscribeRegistry(t, registry)
+	registry.Add(d)
+	receive(t, events)
+
+	// the device got a new address, served by the second server
+	s2.SetStatus(MainZone, "volume", 42)
+	if got := registry.Add(moved); got != d {
+		t.Errorf("Add = %v, want registered device %v", got, d)
+	}
+	if e := receive(t, events); e != (RegistryEvent{DeviceChanged, d}) {
+		t.Errorf("event = %v, want device changed", e)
+	}
+	if got, want := d.location().String(), s2.Location().String(); got != want {
+		t.Errorf("location = %s, want %s", got, want)
+	}
+	if volume := d.Zone(MainZone).GetStatus().Volume; volume != 42 {
+		t.Errorf("volume = %d, want 42 from the new address", volume)
+	}
+
+	// the old address is gone, the device stays alive at the new one
+	s1.Close()
+	registry.Timeout = 50 * time.Millisecond
+	time.Sleep(registry.Timeout)
+	registry.expire(nil)
+	if got := registry.Get(musiccasttest.DeviceID); got != d {
+		t.Errorf("Get = %v, want relocated device %v", got, d)
+	}
+}
+
+func TestRegistryExpire(t *testing.T) {
+	s, d := newTestDevice(t)
+	d.SetRetries(0, 0)
+	registry := NewRegistry()
+	var errs []error
+	registry.OnError = func(err error) { errs = append(errs, err) }
+	events := subscribeRegistry(t, registry)
+	registry.Add(d)
+	receive(t, events)
+
+	// a device answering requests stays registered
+	registry.Timeout = 200 * time.Millisecond
+	time.Sleep(registry.Timeout)
+	registry.expire(nil)
+	if registry.Get(musiccasttest.DeviceID) == nil {
+		t.Fatal("device answering requests expired")
+	}
+
+	// an unreachable device is kept until the timeout
+	s.Close()
+	registry.expire(nil)
+	if registry.Get(musiccasttest.DeviceID) == nil {
+		t.Fatal("device expired before timeout")
+	}
+	if len(errs) != 1 {
+		t.Errorf("errors = %v, want probing error", errs)
+	}
+
+	// events keep it alive past the last successful probe
+	time.Sleep(registry.Timeout / 2)
+	d.activity.touchEvent()
+	time.Sleep(registry.Timeout / 2)
+	registry.expire(nil)
+	if registry.Get(musiccasttest.DeviceID) == nil {
+		t.Fatal("device sending events expired")
+	}
+
+	time.Sleep(registry.Timeout)
+	registry.expire(nil)
+	if e := receive(t, events); e != (RegistryEvent{DeviceRemoved, d}) {
+		t.Errorf("event = %v, want device removed", e)
+	}
+	if got := registry.Get(musiccasttest.DeviceID); got != nil {
+		t.Errorf("Get = %v, want nil", got)
+	}
+}
+
+func TestRegistryAppPort(t *testing.T) {
+	_, d := newTestDevice(t)
+	registry := NewRegistry()
+	registry.setAppPort(41100)
+	registry.Add(d)
+	if port := d.appPort(); port != 41100 {
+		t.Errorf("app port = %d, want 41100", port)
+	}
+
+	// another listener took over
+	registry.setAppPort(41101)
+	registry.releaseAppPort(41100)
+	if port := d.appPort(); port != 41101 {
+		t.Errorf("app port = %d, want 41101", port)
+	}
+
+	registry.releaseAppPort(41101)
+	if port := d.appPort(); port != 0 {
+		t.Errorf("app port = %d, want 0", port)
+	}
+	_, added := newTestDevice(t)
+	registry.Remove(musiccasttest.DeviceID)
+	registry.Add(added)
+	if port := added.appPort(); port != 0 {
+		t.Errorf("app port = %d for device added after release, want 0", port)
+	}
+}
+
+func TestParseHosts(t *testing.T) {
+	hosts := ParseHosts(" 192.168.1.10, receiver.local\tlocalhost:8080,,[::1]:80 \n")
+	want := []string{"192.168.1.10", "receiver.local", "localhost:8080", "[::1]:80"}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Errorf("hosts = %q, want %q", hosts, want)
+	}
+	if hosts := ParseHosts(" , "); len(hosts) != 0 {
+		t.Errorf("hosts = %q, want none", hosts)
+	}
+}
+
+func TestNewDeviceFromHost(t *testing.T) {
+	s := musiccasttest.NewServer()
+	t.Cleanup(s.Close)
+	host := strings.TrimPrefix(s.URL, "http://")
+	d, err := NewDeviceFromHost(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := d.GetDeviceID(); id != musiccasttest.DeviceID {
+		t.Errorf("device id = %q, want %q", id, musiccasttest.DeviceID)
+	}
+	if got := d.host(); got != "127.0.0.1" {
+		t.Errorf("host = %q, want 127.0.0.1", got)
+	}
+
+	for _, bad := range []string{"127.0.0.1:1", "invalid host"} {
+		if _, err := NewDeviceFromHost(bad); err == nil {
+			t.Errorf("expected error for host %q", bad)
+		}
+	}
+}
+
+func TestLoadDevices(t *testing.T) {
+	s := musiccasttest.NewServer()
+	t.Cleanup(s.Close)
+	t.Cleanup(func() { DefaultRegistry.Remove(musiccasttest.DeviceID) })
+	host := strings.TrimPrefix(s.URL, "http://")
+
+	devices, err := LoadDevices(ParseHosts("127.0.0.1:1, " + host))
+	if err == nil || !strings.HasPrefix(err.Error(), "127.0.0.1:1: ") {
+		t.Errorf("error = %v, want error for 127.0.0.1:1", err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("devices = %v, want one device", devices)
+	}
+	if got := DefaultRegistry.Get(musiccasttest.DeviceID); got != devices[0] {
+		t.Errorf("registered device = %v, want %v", got, devices[0])
+	}
+
+	// loading the same host again returns the registered device
+	again, err := LoadDevices([]string{host})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 1 || again[0] != devices[0] {
+		t.Errorf("devices = %v, want %v", again, devices)
+	}
+}
+
+func TestGroupRollback(t *testing.T) {
+	_, master := newTestDevice(t)
+	s1, client1 := newTestDevice(t)
+	s2, client2 := newTestDevice(t)
+
+	s2.FailPath("dist/setClientInfo", 1, http.StatusInternalServerError)
+	if _, err := NewGroup("Party", master, client1, client2); err == nil {
+		t.Fatal("expected error for failed client")
+	}
+	if dist := s1.Distribution(); dist["group_id"] != "" || dist["role"] != "none" {
+		t.Errorf("client distribution = %v, want unlinked", dist)
+	}
+
+	group, err := NewGroup("Party", master, client1, client2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dist := s2.Distribution(); dist["group_id"] != group.GetGroupID() || dist["role"] != "client" {
+		t.Errorf("client distribution = %v, want linked to %s", dist, group.GetGroupID())
+	}
+	if err := group.Dissolve(); err != nil {
+		t.Fatal(err)
+	}
+
+	// an empty client list is sent as [] rather than null
+	if _, err := NewGroup("", master); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGroupRemove(t *testing.T) {
+	s, master := newTestDevice(t)
+	s1, client1 := newTestDevice(t)
+	_, client2 := newTestDevice(t)
+
+	group, err := NewGroup("", master, client1, client2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Distributing() {
+		t.Error("distribution not started")
+	}
+
+	// copies of a device are the same group member
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := group.Remove(client1.WithContext(ctx)); err != nil {
+		t.Fatal(err)
+	}
+	if clients := group.GetClients(); len(clients) != 1 || clients[0] != client2 {
+		t.Errorf("clients = %v, want the second client only", clients)
+	}
+	if dist := s1.Distribution(); dist["group_id"] != "" || dist["role"] != "none" {
+		t.Errorf("client distribution = %v, want unlinked", dist)
+	}
+	if !s.Distributing() {
+		t.Error("distribution stopped with a client left")
+	}
+
+	if err := group.Remove(client2); err != nil {
+		t.Fatal(err)
+	}
+	if clients := group.GetClients(); len(clients) != 0 {
+		t.Errorf("clients = %v, want none", clients)
+	}
+	if s.Distributing() {
+		t.Error("distribution not stopped after removing the last client")
+	}
+}
+
+func TestPlayURL(t *testing.T) {
+	s, d := newTestDevice(t)
+	uri := "http://192.168.1.10/chime.mp3?volume=1&loop=0"
+
+	if err := d.PlayURL(uri, DIDLLite("Doorbell", uri, "audio/mpeg")); err != nil {
+		t.Fatal(err)
+	}
+	if transport := s.Transport(); transport.URI != uri || transport.State != TransportPlaying {
+		t.Errorf("transport = %+v, want playing %s", transport, uri)
+	}
+
+	info, err := d.GetTransportInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State != TransportPlaying {
+		t.Errorf("state = %q, want %q", info.State, TransportPlaying)
+	}
+
+	pos, err := d.GetTransportPosition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos.URI != uri || pos.Duration != 10*time.Second {
+		t.Errorf("position = %+v, want %s lasting 10s", pos, uri)
+	}
+
+	if err := d.StopURL(); err != nil {
+		t.Fatal(err)
+	}
+	if state := s.Transport().State; state != TransportStopped {
+		t.Errorf("state = %q, want %q", state, TransportStopped)
+	}
+}
+
+func TestPlayNotification(t *testing.T) {
+	s, d := newTestDevice(t)
+	uri := "http://192.168.1.10/chime.mp3"
+	metadata := DIDLLite("Doorbell", uri, "audio/mpeg")
+
+	// the clip stops before the first poll and is never seen playing
+	s.SetClipDuration(100 * time.Millisecond)
+	start := time.Now()
+	if err := d.PlayNotification(uri, metadata, 30, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= 2*time.Second {
+		t.Errorf("stopped clip took %s, want less than 2s", elapsed)
+	}
+	if volume := s.Status(MainZone)["volume"]; volume != 20 {
+		t.Errorf("volume = %v after notification, want 20", volume)
+	}
+
+	// the device switches back to another uri
+	s.SetClipDuration(0)
+	s.SetTransport(musiccasttest.Transport{State: TransportNoMedia})
+	done := make(chan error, 1)
+	go func() {
+		done <- d.PlayNotification(uri, metadata, 0, 5*time.Second)
+	}()
+	for transport := s.Transport(); transport.URI != uri || transport.State != TransportPlaying; transport = s.Transport() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.SetTransport(musiccasttest.Transport{URI: "http://192.168.1.10/radio.mp3", State: TransportPlaying})
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for notification to finish")
+	}
+
+	// notifications on the same device do not overlap
+	s.SetClipDuration(100 * time.Millisecond)
+	start = time.Now()
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- d.PlayNotification(uri, metadata, 0, 5*time.Second)
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 2*notificationPollInterval {
+		t.Errorf("notifications took %s, want at least %s", elapsed, 2*notificationPollInterval)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	s, d := newTestDevice(t)
+	d.SetRetries(2, time.Millisecond)
+
+	s.Fail(2, http.StatusServiceUnavailable)
+	if err := d.probe(); err != nil {
+		t.Errorf("query failing twice: %v", err)
+	}
+
+	s.Fail(3, http.StatusServiceUnavailable)
+	if err := d.probe(); err == nil {
+		t.Error("expected error for query failing more often than retried")
+	}
+	s.Fail(0, 0)
+
+	s.Fail(1, http.StatusServiceUnavailable)
+	if err, ok := d.SetVolume(30).(*StatusError); !ok || err.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("error = %v, want unretried service unavailable", err)
+	}
+
+	s.FailResponse(2, ResponseInitializing)
+	if err := d.probe(); err != nil {
+		t.Errorf("query initializing twice: %v", err)
+	}
+	s.FailResponse(1, ResponseInvalidRequest)
+	if err, ok := d.probe().(*ResponseError); !ok || err.Code != ResponseInvalidRequest {
+		t.Errorf("error = %v, want unretried invalid request", err)
+	}
+}
+
+func TestResyncFailure(t *testing.T) {
+	s, d := newTestDevice(t)
+	d.SetRetries(0, 0)
+	updates := subscribe(t, d.Subscribe())
+	want := d.GetStatus()
+
+	s.SetStatus(MainZone, "volume", 30)
+	s.FailPath("main/getStatus", 1, http.StatusInternalServerError)
+	if err := d.resync(); err == nil {
+		t.Fatal("expected error for failed status request")
+	}
+	if status := d.GetStatus(); !reflect.DeepEqual(status, want) {
+		t.Errorf("status = %+v after failed resync, want %+v", status, want)
+	}
+	select {
+	case diff := <-updates:
+		t.Errorf("diff %v published for failed resync", diff)
+	default:
+	}
+
+	if err := d.resync(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := receive(t, updates); !reflect.DeepEqual(diff.(event)["status"], event{"volume": uint64(30)}) {
+		t.Errorf("diff = %v, want volume 30", diff)
+	}
+}
+
+func TestKeepAliveResync(t *testing.T) {
+	s, d := newTestDevice(t)
+	registry := NewRegistry()
+	registry.Add(d)
+	l := NewListener("127.0.0.1:0")
+	l.Registry = registry
+	if err := l.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Stop()
+
+	updates := subscribe(t, d.Subscribe())
+	if err := d.SetVolume(35); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, updates)
+
+	// the device keeps changing but its events are lost
+	s.SetSilent(true)
+	s.SetStatus(MainZone, "volume", 30)
+	errs := make(chan error, 1)
+	d.StartKeepAlive(100*time.Millisecond, 300*time.Millisecond, func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	defer d.StopKeepAlive()
+	if diff := receive(t, updates); !reflect.DeepEqual(diff.(event)["status"], event{"volume": uint64(30)}) {
+		t.Errorf("diff = %v, want volume 30", diff)
+	}
+	select {
+	case err := <-errs:
+		t.Error(err)
+	default:
+	}
+}
+
+func TestContext(t *testing.T) {
+	s, d := newTestDevice(t)
+	s.SetDelay(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := d.WithContext(ctx).SetVolume(30); err == nil {
+		t.Error("expected error for expired context")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("request returned after %v, want about 50ms", elapsed)
+	}
+
+	d.SetTimeout(50 * time.Millisecond)
+	d.SetRetries(0, 0)
+	start = time.Now()
+	if err := d.probe(); err == nil {
+		t.Error("expected error for timed out request")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("request returned after %v, want about 50ms", elapsed)
+	}
+
+	s.SetDelay(0)
+	requests := 0
+	d.SetHTTPClient(&http.Client{Transport: roundTripper(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return http.DefaultTransport.RoundTrip(req)
+	})})
+	if _, err := d.GetTransportInfo(); err != nil || requests != 1 {
+		t.Errorf("transport info sent %d requests with the device client, %v", requests, err)
+	}
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	if err := d.WithContext(canceled).PlayURL(s.URL+"/chime.mp3", ""); err == nil {
+		t.Error("expected error for canceled context")
+	}
+	if err := d.WithContext(canceled).waitForTransport("", time.Minute); err != context.Canceled {
+		t.Errorf("wait error = %v, want canceled", err)
+	}
+}
+
+type roundTripper func(req *http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestSnapshot(t *testing.T) {
+	s, d := newTestDevice(t)
+	if err := d.SetPower(PowerOn); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.resync(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if want := d.Snapshot(); !reflect.DeepEqual(snapshot, want) {
+		t.Errorf("decoded snapshot = %+v, want %+v", snapshot, want)
+	}
+	var main struct {
+		Status Status `json:"status"`
+	}
+	if err := json.Unmarshal(data, &main); err != nil || !reflect.DeepEqual(main.Status, d.GetStatus()) {
+		t.Errorf("encoded status = %+v, %v, want main zone status", main.Status, err)
+	}
+
+	if err := d.RecallScene(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RecallScene(5); err == nil {
+		t.Error("expected error for invalid scene")
+	}
+	if err := d.SetVolume(50); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetMute(true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	status := s.Status(MainZone)
+	for k, want := range map[string]interface{}{"power": "on", "volume": 20, "mute": false, "input": "net_radio"} {
+		if status[k] != want {
+			t.Errorf("%s = %v, want %v", k, status[k], want)
+		}
+	}
+
+	snapshot.DeviceID = "other"
+	if err := d.Restore(snapshot); err == nil {
+		t.Error("expected error for snapshot of another device")
+	}
+}
+
+func TestVolume(t *testing.T) {
+	s, d := newTestDevice(t)
+
+	if percent := d.GetVolumePercent(); math.Abs(percent-100.0/3) > 1e-9 {
+		t.Errorf("volume = %v%%, want 33.3%%", percent)
+	}
+	if db, err := d.GetVolumeDB(); err != nil || db != -70.5 {
+		t.Errorf("volume = %v dB, %v, want -70.5 dB", db, err)
+	}
+
+	if err := d.SetVolumePercent(50); err != nil {
+		t.Fatal(err)
+	}
+	if volume := s.Status(MainZone)["volume"]; volume != musiccasttest.MaxVolume/2 {
+		t.Errorf("volume = %v, want %v", volume, musiccasttest.MaxVolume/2)
+	}
+	if err := d.SetVolumePercent(101); err == nil {
+		t.Error("expected error for percentage out of range")
+	}
+
+	if err := d.SetVolumeDB(-60.2); err != nil {
+		t.Fatal(err)
+	}
+	if volume := s.Status(MainZone)["volume"]; volume != 41 {
+		t.Errorf("volume = %v, want 41 for -60.0 dB", volume)
+	}
+	if err := d.SetVolumeDB(0); err == nil {
+		t.Error("expected error for dB out of range")
+	}
+}
+
+func TestArtworkCache(t *testing.T) {
+	c := NewArtworkCache(10)
+	c.Put(Artwork{Hash: "a", Data: make([]byte, 4)})
+	c.Put(Artwork{Hash: "b", Data: make([]byte, 4)})
+	c.Get("a")
+	c.Put(Artwork{Hash: "c", Data: make([]byte, 4)})
+	if _, ok := c.Get("b"); ok {
+		t.Error("least recently used image not evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("recently used image evicted")
+	}
+	if a, _ := c.Get("a"); len(a.Data) > 0 {
+		a.Data[0] = 1
+		if b, _ := c.Get("a"); b.Data[0] != 0 {
+			t.Error("cached image modified through a returned copy")
+		}
+	}
+	c.Put(Artwork{Hash: "d", Data: make([]byte, 11)})
+	if _, ok := c.Get("d"); ok || c.Len() != 2 {
+		t.Errorf("image larger than cache added, %d images cached", c.Len())
+	}
+}
+
+func TestAlbumArt(t *testing.T) {
+	s, d := newTestDevice(t)
+	updates := subscribe(t, d.SubscribeArtwork())
+
+	if a, err := d.AlbumArt(); err != nil || a.Hash != "" {
+		t.Errorf("album art = %+v, %v, want none", a, err)
+	}
+
+	data := []byte("\x89PNG\r\n\x1a\nalbum art")
+	s.SetAlbumArt("/YamahaRemoteControl/AlbumART/AlbumART1.png", "image/png", data)
+	err := d.processEvent(event{"device_id": musiccasttest.DeviceID, "netusb": map[string]interface{}{"play_info_updated": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := receive(t, updates).(ArtworkEvent)
+	if !ok || e.Err != nil || e.DeviceID != musiccasttest.DeviceID {
+		t.Fatalf("artwork event = %+v", e)
+	}
+	if e.Artwork.ContentType != "image/png" || string(e.Artwork.Data) != string(data) {
+		t.Errorf("artwork = %s %q, want image/png %q", e.Artwork.ContentType, e.Artwork.Data, data)
+	}
+
+	u, err := d.AlbumArtURL()
+	if err != nil || u.String() != s.URL+"/YamahaRemoteControl/AlbumART/AlbumART1.png" {
+		t.Errorf("album art url = %v, %v", u, err)
+	}
+
+	// album art downloads are retried and announce the app like the YXC requests
+	var headers []http.Header
+	d.SetHTTPClient(&http.Client{Transport: roundTripper(func(req *http.Request) (*http.Response, error) {
+		headers = append(headers, req.Header)
+		return http.DefaultTransport.RoundTrip(req)
+	})})
+	d.SetAppPort(41100)
+	d.SetRetries(1, time.Millisecond)
+	s.FailPath(u.Path, 1, http.StatusServiceUnavailable)
+	if a, err := d.fetchAlbumArt(u.Path); err != nil || a.Hash != e.Artwork.Hash {
+		t.Errorf("album art = %+v, %v, want %s after retry", a, err, e.Artwork.Hash)
+	}
+	if len(headers) != 2 {
+		t.Fatalf("album art sent %d requests, want 2", len(headers))
+	}
+	if h := headers[0]; h.Get("X-AppName") == "" || h.Get("X-AppPort") != "41100" {
+		t.Errorf("album art headers = %v, want app name and port", h)
+	}
+	d.SetRetries(0, 0)
+	s.FailPath(u.Path, 1, http.StatusServiceUnavailable)
+	if _, err := d.fetchAlbumArt(u.Path); err == nil {
+		t.Error("expected error for album art failing without retries")
+	}
+	s.Close()
+	if a, err := d.AlbumArt(); err != nil || a.Hash != e.Artwork.Hash {
+		t.Errorf("album art = %+v, %v, want cached %s", a, err, e.Artwork.Hash)
+	}
+}
+
+func TestBrowser(t *testing.T) {
+	s, d := newTestDevice(t)
+	var tracks []musiccasttest.ListItem
+	for i := 1; i <= 20; i++ {
+		tracks = append(tracks, musiccasttest.ListItem{Text: fmt.Sprintf("Track %d", i)})
+	}
+	s.SetList("server", []musiccasttest.ListItem{{Text: "Music", Items: tracks}, {Text: "Jingle"}})
+	b := d.Browser()
+
+	if _, err := b.NextPage(); err == nil {
+		t.Error("expected error for unopened browser")
+	}
+	list, err := b.Open("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.MaxLine != 2 || len(list.Items) != 2 || !list.Items[0].IsSelectable() || !list.Items[1].IsPlayable() {
+		t.Errorf("list = %+v, want a folder and a track", list)
+	}
+
+	list, err = b.Select(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.MenuName != "Music" || list.MenuLayer != 1 || list.MaxLine != 20 || len(list.Items) != ListPageSize {
+		t.Errorf("list = %+v, want first page of 20 tracks", list)
+	}
+	for _, page := range []struct{ index, items int }{{8, 8}, {16, 4}} {
+		list, err = b.NextPage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if list.Index != page.index || len(list.Items) != page.items || list.Items[0].Text != fmt.Sprintf("Track %d", page.index+1) {
+			t.Errorf("list = %+v, want %d tracks from %d", list, page.items, page.index)
+		}
+	}
+	if _, err := b.NextPage(); err == nil {
+		t.Error("expected error past the last page")
+	}
+	if _, err := b.Page(-1); err == nil {
+		t.Error("expected error for negative index")
+	}
+	if list, err = b.PreviousPage(); err != nil || list.Index != 8 {
+		t.Errorf("list = %+v, %v, want page at 8", list, err)
+	}
+	if got := b.GetList(); !reflect.DeepEqual(got, list) {
+		t.Errorf("current list = %+v, want %+v", got, list)
+	}
+
+	if err := b.Play(9); err != nil {
+		t.Fatal(err)
+	}
+	if playback := s.Playback(); playback["track"] != "Track 10" || playback["playback"] != "play" {
+		t.Errorf("playback = %v, want Track 10 playing", playback)
+	}
+	if list, err = b.Return(); err != nil || list.MenuLayer != 0 || list.MaxLine != 2 {
+		t.Errorf("list = %+v, %v, want root list", list, err)
+	}
+	if _, err := b.Select(1); err == nil {
+		t.Error("expected error for selecting a track")
+	}
+}
+
+func TestBrowserPresets(t *testing.T) {
+	s, d := newTestDevice(t)
+	s.SetList("server", []musiccasttest.ListItem{{Text: "Jingle"}, {Text: "Chime"}})
+	b := d.Browser()
+	if _, err := b.Open("server"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Play(0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, num := range []int{0, 41} {
+		if err := b.StorePreset(num); err == nil {
+			t.Errorf("expected error for preset %d", num)
+		}
+	}
+	if err := b.StorePreset(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.RecallPreset(1); err == nil {
+		t.Error("expected error for empty preset")
+	}
+	if err := b.Play(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.RecallPreset(3); err != nil {
+		t.Fatal(err)
+	}
+	if track := s.Playback()["track"]; track != "Jingle" {
+		t.Errorf("track = %v after recalling preset, want Jingle", track)
+	}
+	if err := s.SetPlayQueue("A", "B", "C"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.resync(); err != nil {
+		t.Fatal(err)
+	}
+	if presets := b.GetPresets(); len(presets) != 40 || presets[2] != (Preset{Input: "server", Text: "Jingle"}) {
+		t.Errorf("presets = %+v, want Jingle as third preset", presets)
+	}
+
+	recent := b.GetRecentItems()
+	if len(recent) != 2 || recent[0].Text != "Jingle" || recent[0].PlayCount != 2 || recent[1].Text != "Chime" {
+		t.Fatalf("recent items = %+v, want Jingle and Chime", recent)
+	}
+	if err := b.RecallRecentItem(2); err != nil {
+		t.Fatal(err)
+	}
+	if track := s.Playback()["track"]; track != "Chime" {
+		t.Errorf("track = %v after recalling recent item, want Chime", track)
+	}
+	if err := b.RecallRecentItem(3); err == nil {
+		t.Error("expected error for unknown recent item")
+	}
+
+	queue := func() (texts []string, playing int) {
+		t.Helper()
+		if err := d.resync(); err != nil {
+			t.Fatal(err)
+		}
+		q := b.GetPlayQueue()
+		for _, item := range q.Items {
+			texts = append(texts, item.Text)
+		}
+		if q.MaxLine != len(texts) {
+			t.Errorf("play queue = %+v, want max line %d", q, len(texts))
+		}
+		return texts, q.PlayingIndex
+	}
+	for _, step := range []struct {
+		action  string
+		index   int
+		queue   []string
+		playing int
+	}{
+		{PlayQueuePlay, 2, []string{"A", "B", "C"}, 2},
+		{PlayQueueMoveDown, 0, []string{"B", "A", "C"}, 2},
+		{PlayQueueMoveUp, 2, []string{"B", "C", "A"}, 2},
+		{PlayQueueRemove, 0, []string{"C", "A"}, 1},
+		{PlayQueueClear, 0, nil, -1},
+	} {
+		if err := b.ManagePlayQueue(step.action, step.index); err != nil {
+			t.Fatalf("%s %d: %v", step.action, step.index, err)
+		}
+		if texts, playing := queue(); !reflect.DeepEqual(texts, step.queue) || playing != step.playing {
+			t.Errorf("%s %d: play queue = %q playing %d, want %q playing %d", step.action, step.index, texts, playing, step.queue, step.playing)
+		}
+	}
+	if err := b.ManagePlayQueue(PlayQueueRemove, 0); err == nil {
+		t.Error("expected error for removing from an empty play queue")
+	}
+}
+
+func TestTuner(t *testing.T) {
+	_, d := newTestDevice(t)
+	tuner := d.Tuner()
+	playback := func() TunerPlayback {
+		t.Helper()
+		if err := d.resync(); err != nil {
+			t.Fatal(err)
+		}
+		return tuner.GetPlayback()
+	}
+
+	if err := tuner.SetBand("xm"); err == nil {
+		t.Error("expected error for unsupported band")
+	}
+	if err := tuner.SetBand(BandAM); err != nil {
+		t.Fatal(err)
+	}
+	if band := playback().Band; band != BandAM {
+		t.Errorf("band = %q, want %q", band, BandAM)
+	}
+
+	for _, freq := range []struct {
+		band  string
+		freq  int
+		valid bool
+	}{
+		{BandFM, 98100, true},
+		{BandFM, 98120, false},
+		{BandFM, 87450, false},
+		{BandFM, 108050, false},
+		{BandAM, 540, true},
+		{BandAM, 535, false},
+		{BandAM, 1620, false},
+	} {
+		if err := tuner.SetFrequency(freq.band, freq.freq); (err == nil) != freq.valid {
+			t.Errorf("%s frequency %d: error = %v, want valid %t", freq.band, freq.freq, err, freq.valid)
+		}
+	}
+	if p := playback(); p.Band != BandAM || p.AM.Freq != 540 || p.FM.Freq != 98100 {
+		t.Errorf("playback = %+v, want AM 540 and FM 98100", p)
+	}
+	if err := tuner.Tune(BandFM, TuningUp); err != nil {
+		t.Fatal(err)
+	}
+	if p := playback(); p.Band != BandFM || p.FM.Freq != 98150 {
+		t.Errorf("playback = %+v, want FM 98150", p)
+	}
+
+	for _, num := range []int{0, 41} {
+		if err := tuner.StorePreset(num); err == nil {
+			t.Errorf("expected error for preset %d", num)
+		}
+	}
+	if err := tuner.StorePreset(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tuner.SetBand(BandDAB); err != nil {
+		t.Fatal(err)
+	}
+	if err := tuner.SetDABService(DirectionNext); err != nil {
+		t.Fatal(err)
+	}
+	if p := playback(); p.DAB.ServiceLabel != musiccasttest.DABServices[1] {
+		t.Errorf("DAB service = %q, want %q", p.DAB.ServiceLabel, musiccasttest.DABServices[1])
+	}
+	if err := tuner.StorePreset(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := tuner.RecallPreset(BandCommon, 3); err == nil {
+		t.Error("expected error for empty preset")
+	}
+	if err := tuner.RecallPreset(BandCommon, 1); err != nil {
+		t.Fatal(err)
+	}
+	if p := playback(); p.Band != BandFM || p.FM.Freq != 98150 || p.FM.Preset != 1 {
+		t.Errorf("playback = %+v, want preset 1 on FM 98150", p)
+	}
+	if err := tuner.SwitchPreset(DirectionNext); err != nil {
+		t.Fatal(err)
+	}
+	if p := playback(); p.Band != BandDAB || p.DAB.Preset != 2 || p.DAB.ServiceLabel != musiccasttest.DABServices[1] {
+		t.Errorf("playback = %+v, want preset 2 on DAB", p)
+	}
+	presets := tuner.GetPresets()
+	if len(presets) != 40 || presets[0] != (TunerPreset{BandFM, 98150, ""}) || presets[1] != (TunerPreset{BandDAB, 1, musiccasttest.DABServices[1]}) {
+		t.Errorf("presets = %+v, want FM and DAB presets", presets[:2])
+	}
+}
+
+func TestCD(t *testing.T) {
+	s, d := newTestDevice(t)
+	cd := d.CD()
+	playback := func() CDPlayback {
+		t.Helper()
+		if err := d.resync(); err != nil {
+			t.Fatal(err)
+		}
+		return cd.GetPlayback()
+	}
+
+	if p := playback(); p.DeviceStatus != "ready" || p.TotalTracks != musiccasttest.DiscTracks {
+		t.Errorf("playback = %+v, want a ready disc", p)
+	}
+	if err := cd.SelectTrack(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := cd.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if p := playback(); p.Playback != "play" || p.TrackNumber != 4 {
+		t.Errorf("playback = %+v, want track 4 playing", p)
+	}
+	if err := cd.SelectTrack(musiccasttest.DiscTracks + 1); err == nil {
+		t.Error("expected error for invalid track")
+	}
+	if err := cd.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if playback := s.CD()["playback"]; playback != "pause" {
+		t.Errorf("playback = %v, want pause", playback)
+	}
+
+	for _, repeat := range []string{"one", "all", "off"} {
+		if err := cd.ToggleRepeat(); err != nil {
+			t.Fatal(err)
+		}
+		if p := playback(); p.Repeat != repeat {
+			t.Errorf("repeat = %q, want %q", p.Repeat, repeat)
+		}
+	}
+	if err := cd.ToggleShuffle(); err != nil {
+		t.Fatal(err)
+	}
+	if p := playback(); p.Shuffle != "on" {
+		t.Errorf("shuffle = %q, want on", p.Shuffle)
+	}
+
+	if err := cd.ToggleTray(); err != nil {
+		t.Fatal(err)
+	}
+	if p := playback(); p.DeviceStatus != "open" || p.Playback != "stop" {
+		t.Errorf("playback = %+v, want open tray", p)
+	}
+	if err := cd.Play(); err == nil {
+		t.Error("expected error for playing with open tray")
+	}
+}
+
+func TestBluetooth(t *testing.T) {
+	_, d := newTestDevice(t)
+	bt := d.Bluetooth()
+	info := func() BluetoothInfo {
+		t.Helper()
+		if err := d.resync(); err != nil {
+			t.Fatal(err)
+		}
+		return bt.GetInfo()
+	}
+
+	if err := bt.SetStandby(true); err != nil {
+		t.Fatal(err)
+	}
+	address := musiccasttest.BluetoothDevices[1]["address"].(string)
+	if err := bt.Connect(address); err == nil {
+		t.Error("expected error for connecting without transmission")
+	}
+	if err := bt.SetTransmission(true); err != nil {
+		t.Fatal(err)
+	}
+	if i := info(); !i.Standby || !i.TxSetting || i.Device.Connected {
+		t.Errorf("info = %+v, want standby and transmission without device", i)
+	}
+
+	if devices, err := bt.GetDevices(); err != nil || len(devices) != 0 {
+		t.Errorf("devices = %+v, %v, want none before searching", devices, err)
+	}
+	if err := bt.UpdateDevices(); err != nil {
+		t.Fatal(err)
+	}
+	devices, err := bt.GetDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != len(musiccasttest.BluetoothDevices) || devices[1].Address != address || devices[1].Name != "Speaker" {
+		t.Errorf("devices = %+v, want the devices found", devices)
+	}
+	if err := bt.Connect("00:00:00:00:00:00"); err == nil {
+		t.Error("expected error for unknown device")
+	}
+	if err := bt.Connect(address); err != nil {
+		t.Fatal(err)
+	}
+	if i := info(); !i.Device.Connected || i.Device.Address != address {
+		t.Errorf("info = %+v, want connected to %s", i, address)
+	}
+	if err := bt.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if i := info(); i.Device.Connected {
+		t.Errorf("info = %+v, want disconnected", i)
+	}
+}
+
+func TestClock(t *testing.T) {
+	s, d := newTestDevice(t)
+	clock := d.Clock()
+	settings := func() ClockSettings {
+		t.Helper()
+		if err := d.resync(); err != nil {
+			t.Fatal(err)
+		}
+		return clock.GetSettings()
+	}
+	oneDay := settings().Alarm.OneDay
+
+	alarm := Alarm{AlarmOn: true, Volume: 25, FadeInterval: 3, FadeType: 1, Mode: AlarmModeWeekly, Repeat: true}
+	monday := AlarmDay{Enable: true, PlaybackType: AlarmPlaybackResume, Resume: AlarmResume{InputTuner}}
+	monday.SetTimeOfDay(6*time.Hour + 30*time.Minute)
+	alarm.SetDay(time.Monday, monday)
+	alarm.SetDay(time.Friday, AlarmDay{Enable: true, Time: "0715", Beep: true})
+	if err := clock.SetAlarm(alarm); err != nil {
+		t.Fatal(err)
+	}
+	alarm.OneDay = oneDay
+	if got := settings().Alarm; !reflect.DeepEqual(got, alarm) {
+		t.Errorf("alarm = %+v, want %+v", got, alarm)
+	}
+	if tod := clock.GetSettings().Alarm.Day(time.Monday).TimeOfDay(); tod != 6*time.Hour+30*time.Minute {
+		t.Errorf("monday alarm at %s, want 6h30m", tod)
+	}
+
+	weekly := alarm
+	alarm.Mode = AlarmModeOneDay
+	alarm.OneDay = AlarmDay{Enable: true, Time: "0900", PlaybackType: AlarmPlaybackPreset, Preset: AlarmPreset{"netusb", 2}}
+	if err := clock.SetAlarm(alarm); err != nil {
+		t.Fatal(err)
+	}
+	weekly.Mode, weekly.OneDay = AlarmModeOneDay, alarm.OneDay
+	if got := settings().Alarm; !reflect.DeepEqual(got, weekly) {
+		t.Errorf("alarm = %+v, want %+v", got, weekly)
+	}
+
+	for _, invalid := range []func(*Alarm){
+		func(a *Alarm) { a.Volume = musiccasttest.MaxAlarmVolume + 1 },
+		func(a *Alarm) { a.FadeInterval = -1 },
+		func(a *Alarm) { a.Mode = "daily" },
+		func(a *Alarm) { a.OneDay.PlaybackType, a.OneDay.Resume.Input = AlarmPlaybackResume, InputAUX },
+	} {
+		a := alarm
+		invalid(&a)
+		if err := clock.SetAlarm(a); err == nil {
+			t.Errorf("expected error for alarm %+v", a)
+		}
+	}
+
+	if err := clock.EnableAlarm(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := clock.SetAutoSync(false); err != nil {
+		t.Fatal(err)
+	}
+	if got := settings(); got.Alarm.AlarmOn || got.AutoSync {
+		t.Errorf("settings = %+v, want alarm and auto sync off", got)
+	}
+	if err := clock.SetDateAndTime(time.Date(2018, 12, 24, 6, 30, 0, 0, time.Local)); err != nil {
+		t.Fatal(err)
+	}
+	if dateTime := s.DateAndTime(); dateTime != "181224063000" {
+		t.Errorf("date and time = %q, want 181224063000", dateTime)
+	}
+}
@@ -0,0 +1,70 @@
+package musiccasttest
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// BluetoothDevices are the Bluetooth devices found when searching.
+var BluetoothDevices = []map[string]interface{}{
+	{"address": "00:11:22:33:44:55", "name": "Headphones", "type": "headphone"},
+	{"address": "66:77:88:99:aa:bb", "name": "Speaker", "type": "speaker"},
+}
+
+// bluetooth is the Bluetooth state of the server.
+type bluetooth struct {
+	standby   bool
+	txSetting bool
+	devices   []map[string]interface{}
+	connected map[string]interface{}
+}
+
+// bluetoothRequest handles the system/*Bluetooth* requests, with the server locked.
+func (s *Server) bluetoothRequest(method string, params url.Values) (code int, data map[string]interface{}, fragments map[string]interface{}) {
+	b := &s.bluetooth
+	switch method {
+	case "getBluetoothInfo":
+		device := map[string]interface{}{"address": "", "name": "", "type": "", "connected": false}
+		if b.connected != nil {
+			for k, v := range b.connected {
+				device[k] = v
+			}
+			device["connected"] = true
+		}
+		return codeOK, map[string]interface{}{"bluetooth_standby": b.standby, "bluetooth_tx_setting": b.txSetting, "bluetooth_device": device}, nil
+	case "setBluetoothStandby", "setBluetoothTxSetting":
+		enable, err := strconv.ParseBool(params.Get("enable"))
+		if err != nil {
+			return codeInvalidParameter, nil, nil
+		}
+		if method == "setBluetoothStandby" {
+			b.standby = enable
+		} else {
+			b.txSetting = enable
+		}
+	case "updateBluetoothDeviceList":
+		b.devices = BluetoothDevices
+		return codeOK, nil, nil
+	case "getBluetoothDeviceList":
+		devices := append([]map[string]interface{}{}, b.devices...)
+		return codeOK, map[string]interface{}{"updating": false, "device_list": devices}, nil
+	case "connectBluetoothDevice":
+		if !b.txSetting {
+			return codeInvalidRequest, nil, nil
+		}
+		b.connected = nil
+		for _, device := range b.devices {
+			if device["address"] == params.Get("address") {
+				b.connected = device
+			}
+		}
+		if b.connected == nil {
+			return codeInvalidParameter, nil, nil
+		}
+	case "disconnectBluetoothDevice":
+		b.connected = nil
+	default:
+		return codeInvalidRequest, nil, nil
+	}
+	return codeOK, nil, map[string]interface{}{"system": map[string]interface{}{"bluetooth_info_updated": true}}
+}
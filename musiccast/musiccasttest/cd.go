@@ -0,0 +1,85 @@
+package musiccasttest
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// DiscTracks is the number of tracks of the disc in the CD player.
+const DiscTracks = 12
+
+func newCD() map[string]interface{} {
+	return map[string]interface{}{
+		"device_status": "ready",
+		"playback":      "stop",
+		"repeat":        "off",
+		"shuffle":       "off",
+		"play_time":     0,
+		"total_time":    0,
+		"disc_time":     DiscTracks * 180,
+		"track_number":  1,
+		"total_tracks":  DiscTracks,
+		"artist":        "",
+		"album":         "",
+		"track":         "",
+	}
+}
+
+// CD returns a copy of the CD player play info.
+func (s *Server) CD() map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	cd := make(map[string]interface{})
+	for k, v := range s.cd {
+		cd[k] = v
+	}
+	return cd
+}
+
+// cdRequest handles the cd/* requests, with the server locked.
+func (s *Server) cdRequest(method string, params url.Values) (code int, data map[string]interface{}, fragments map[string]interface{}) {
+	cd := s.cd
+	switch method {
+	case "getPlayInfo":
+		return codeOK, cd, nil
+	case "setPlayback":
+		if cd["device_status"] != "ready" {
+			return codeInvalidRequest, nil, nil
+		}
+		track := cd["track_number"].(int)
+		switch playback := params.Get("playback"); playback {
+		case "play", "pause", "stop":
+			cd["playback"] = playback
+		case "next", "previous":
+			if playback == "next" {
+				track = track%DiscTracks + 1
+			} else {
+				track = (track+DiscTracks-2)%DiscTracks + 1
+			}
+			cd["playback"] = "play"
+		case "track_select":
+			num, err := strconv.Atoi(params.Get("num"))
+			if err != nil || num < 1 || num > DiscTracks {
+				return codeInvalidParameter, nil, nil
+			}
+			track = num
+			cd["playback"] = "play"
+		default:
+			return codeInvalidParameter, nil, nil
+		}
+		cd["track_number"] = track
+	case "toggleTray":
+		if cd["device_status"] == "ready" {
+			cd["device_status"], cd["playback"] = "open", "stop"
+		} else {
+			cd["device_status"] = "ready"
+		}
+	case "toggleRepeat":
+		cd["repeat"] = map[interface{}]string{"off": "one", "one": "all", "all": "off"}[cd["repeat"]]
+	case "toggleShuffle":
+		cd["shuffle"] = map[interface{}]string{"off": "on", "on": "off"}[cd["shuffle"]]
+	default:
+		return codeInvalidRequest, nil, nil
+	}
+	return codeOK, nil, map[string]interface{}{"cd": map[string]interface{}{"play_info_updated": true}}
+}
@@ -0,0 +1,122 @@
+package musiccasttest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Alarm ranges.
+const (
+	MaxAlarmVolume = MaxVolume
+	MaxAlarmFade   = 9
+)
+
+// alarmDays maps the alarm days of clock/setAlarmSettings to their clock/getSettings keys.
+var alarmDays = map[string]string{
+	"oneday":    "one_day",
+	"sunday":    "sunday",
+	"monday":    "monday",
+	"tuesday":   "tuesday",
+	"wednesday": "wednesday",
+	"thursday":  "thursday",
+	"friday":    "friday",
+	"saturday":  "saturday",
+}
+
+func newClock() map[string]interface{} {
+	alarm := map[string]interface{}{
+		"alarm_on":      false,
+		"volume":        20,
+		"fade_interval": 0,
+		"fade_type":     0,
+		"mode":          "oneday",
+		"repeat":        false,
+	}
+	for _, key := range alarmDays {
+		alarm[key] = map[string]interface{}{
+			"enable":        false,
+			"time":          "0000",
+			"beep":          false,
+			"playback_type": "resume",
+			"resume":        map[string]interface{}{"input": "net_radio"},
+			"preset":        map[string]interface{}{"type": "netusb", "num": 1},
+		}
+	}
+	return map[string]interface{}{"auto_sync": true, "format": "24h", "alarm": alarm}
+}
+
+// DateAndTime returns the date and time last set with clock/setDateAndTime, in the YYMMDDhhmmss format.
+func (s *Server) DateAndTime() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.dateTime
+}
+
+// clockRequest handles the clock/* requests, with the server locked.
+func (s *Server) clockRequest(method string, r *http.Request) (code int, data map[string]interface{}, fragments map[string]interface{}) {
+	params := r.URL.Query()
+	switch method {
+	case "getSettings":
+		return codeOK, s.clock, nil
+	case "setAutoSync":
+		enable, err := strconv.ParseBool(params.Get("enable"))
+		if err != nil {
+			return codeInvalidParameter, nil, nil
+		}
+		s.clock["auto_sync"] = enable
+	case "setDateAndTime":
+		dateTime := params.Get("date_time")
+		if _, err := strconv.ParseUint(dateTime, 10, 64); err != nil || len(dateTime) != 12 {
+			return codeInvalidParameter, nil, nil
+		}
+		s.dateTime = dateTime
+		return codeOK, nil, nil
+	case "setAlarmSettings":
+		var body map[string]interface{}
+		if r.Method != "POST" || json.NewDecoder(r.Body).Decode(&body) != nil {
+			return codeInvalidParameter, nil, nil
+		}
+		if code = setAlarm(s.clock["alarm"].(map[string]interface{}), body); code != codeOK {
+			return code, nil, nil
+		}
+	default:
+		return codeInvalidRequest, nil, nil
+	}
+	return codeOK, nil, map[string]interface{}{"clock": map[string]interface{}{"settings_updated": true}}
+}
+
+// setAlarm applies the settings of a clock/setAlarmSettings request to the alarm, unless they are invalid.
+func setAlarm(alarm, body map[string]interface{}) (code int) {
+	var day map[string]interface{}
+	detail, hasDetail := body["detail"].(map[string]interface{})
+	if hasDetail {
+		name, _ := detail["day"].(string)
+		key, ok := alarmDays[name]
+		if !ok {
+			return codeInvalidParameter
+		}
+		day = alarm[key].(map[string]interface{})
+	}
+	if volume, ok := body["volume"].(float64); ok && (volume < 0 || volume > MaxAlarmVolume) {
+		return codeInvalidParameter
+	}
+	if fade, ok := body["fade_interval"].(float64); ok && (fade < 0 || fade > MaxAlarmFade) {
+		return codeInvalidParameter
+	}
+	if mode, ok := body["mode"]; ok && mode != "oneday" && mode != "weekly" {
+		return codeInvalidParameter
+	}
+
+	for k, v := range body {
+		if k != "detail" {
+			alarm[k] = v
+		}
+	}
+	for k, v := range detail {
+		if k != "day" {
+			day[k] = v
+		}
+	}
+	return codeOK
+}
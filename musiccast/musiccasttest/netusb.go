@@ -0,0 +1,247 @@
+package musiccasttest
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// ListPageSize is the maximum number of list items returned at once.
+const ListPageSize = 8
+
+const (
+	presetNum = 40
+	recentNum = 40
+	queueSize = 200
+)
+
+const (
+	attributeSelectable = 0x2
+	attributePlayable   = 0x4
+)
+
+// ListItem is an item of a Net/USB list. Items with sub items can be
+// selected, the others can be played.
+type ListItem struct {
+	Text  string
+	Items []ListItem
+}
+
+// netusb is the Net/USB browsing state of the server.
+type netusb struct {
+	lists    map[string][]ListItem
+	input    string
+	path     []int
+	presets  []map[string]interface{}
+	recent   []map[string]interface{}
+	queue    []string
+	queueNum int
+}
+
+func newNetUSB() netusb {
+	n := netusb{lists: make(map[string][]ListItem), recent: []map[string]interface{}{}, queueNum: -1}
+	for i := 0; i < presetNum; i++ {
+		n.presets = append(n.presets, map[string]interface{}{"input": "unknown", "text": ""})
+	}
+	return n
+}
+
+// SetList sets the root list served when browsing the given input.
+func (s *Server) SetList(input string, items []ListItem) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.netusb.lists[input] = items
+	if s.netusb.input == input {
+		s.netusb.path = nil
+	}
+}
+
+// SetPlayQueue replaces the play queue with the given tracks.
+func (s *Server) SetPlayQueue(tracks ...string) error {
+	if len(tracks) > queueSize {
+		return fmt.Errorf("play queue exceeds %d tracks", queueSize)
+	}
+	s.mutex.Lock()
+	s.netusb.queue = append([]string(nil), tracks...)
+	s.netusb.queueNum = -1
+	s.mutex.Unlock()
+	return s.SendEvent(map[string]interface{}{"netusb": map[string]interface{}{"play_queue": map[string]interface{}{"updated": true}}})
+}
+
+// netusbRequest handles the netusb/* requests, with the server locked.
+func (s *Server) netusbRequest(method string, params url.Values) (code int, data map[string]interface{}, fragments map[string]interface{}) {
+	n := &s.netusb
+	switch method {
+	case "getPlayInfo":
+		return codeOK, s.playback, nil
+	case "setPlayback":
+		code, fragments = s.setPlayback(params.Get("playback"))
+		return code, nil, fragments
+	case "getListInfo":
+		index, err := strconv.Atoi(params.Get("index"))
+		size, sizeErr := strconv.Atoi(params.Get("size"))
+		if err != nil || sizeErr != nil || index < 0 || size < 1 || size > ListPageSize {
+			return codeInvalidParameter, nil, nil
+		}
+		input := params.Get("input")
+		if input != n.input {
+			n.input, n.path = input, nil
+		}
+		items, name := n.list()
+		if index > len(items) {
+			return codeInvalidParameter, nil, nil
+		}
+		page := []map[string]interface{}{}
+		for _, item := range items[index:min(index+size, len(items))] {
+			page = append(page, map[string]interface{}{"text": item.Text, "thumbnail": "", "attribute": item.attribute()})
+		}
+		return codeOK, map[string]interface{}{
+			"input":         input,
+			"menu_layer":    len(n.path),
+			"max_line":      len(items),
+			"index":         index,
+			"playing_index": -1,
+			"menu_name":     name,
+			"list_info":     page,
+		}, nil
+	case "setListControl":
+		if n.input == "" || params.Get("list_id") != "main" {
+			return codeInvalidRequest, nil, nil
+		}
+		items, _ := n.list()
+		action := params.Get("type")
+		if action == "return" {
+			if len(n.path) > 0 {
+				n.path = n.path[:len(n.path)-1]
+			}
+			return codeOK, nil, nil
+		}
+		index, err := strconv.Atoi(params.Get("index"))
+		if err != nil || index < 0 || index >= len(items) {
+			return codeInvalidParameter, nil, nil
+		}
+		item := items[index]
+		switch {
+		case action == "select" && item.Items != nil:
+			n.path = append(n.path, index)
+			return codeOK, nil, nil
+		case action == "play" && item.Items == nil:
+			return codeOK, nil, s.play(n.input, item.Text)
+		}
+		return codeInvalidParameter, nil, nil
+	case "getPresetInfo":
+		return codeOK, map[string]interface{}{"preset_info": n.presets}, nil
+	case "storePreset":
+		num, err := strconv.Atoi(params.Get("num"))
+		if err != nil || num < 1 || num > len(n.presets) || s.playback["track"] == "" {
+			return codeInvalidParameter, nil, nil
+		}
+		n.presets[num-1] = map[string]interface{}{"input": s.playback["input"], "text": s.playback["track"]}
+		return codeOK, nil, map[string]interface{}{"netusb": map[string]interface{}{"preset_info_updated": true}}
+	case "recallPreset":
+		num, err := strconv.Atoi(params.Get("num"))
+		if err != nil || num < 1 || num > len(n.presets) || n.presets[num-1]["input"] == "unknown" {
+			return codeInvalidParameter, nil, nil
+		}
+		preset := n.presets[num-1]
+		return codeOK, nil, s.play(preset["input"].(string), preset["text"].(string))
+	case "getRecentInfo":
+		return codeOK, map[string]interface{}{"recent_info": n.recent}, nil
+	case "recallRecentItem":
+		num, err := strconv.Atoi(params.Get("num"))
+		if err != nil || num < 1 || num > len(n.recent) {
+			return codeInvalidParameter, nil, nil
+		}
+		item := n.recent[num-1]
+		return codeOK, nil, s.play(item["input"].(string), item["text"].(string))
+	case "getPlayQueue":
+		queue := []map[string]interface{}{}
+		for _, track := range n.queue {
+			queue = append(queue, map[string]interface{}{"text": track, "thumbnail": "", "attribute": attributePlayable})
+		}
+		return codeOK, map[string]interface{}{"index": 0, "max_line": len(n.queue), "playing_index": n.queueNum, "play_queue": queue}, nil
+	case "manageList":
+		return n.manageQueue(params)
+	}
+	return codeInvalidRequest, nil, nil
+}
+
+// manageQueue handles netusb/manageList for the play queue.
+func (n *netusb) manageQueue(params url.Values) (code int, data map[string]interface{}, fragments map[string]interface{}) {
+	index, err := strconv.Atoi(params.Get("index"))
+	action := params.Get("type")
+	if params.Get("list_id") != "play_queue" || (action != "clear" && (err != nil || index < 0 || index >= len(n.queue))) {
+		return codeInvalidParameter, nil, nil
+	}
+	switch action {
+	case "play":
+		n.queueNum = index
+	case "remove":
+		n.queue = append(n.queue[:index], n.queue[index+1:]...)
+		if n.queueNum == index {
+			n.queueNum = -1
+		} else if n.queueNum > index {
+			n.queueNum--
+		}
+	case "move_up", "move_down":
+		other := index - 1
+		if action == "move_down" {
+			other = index + 1
+		}
+		if other < 0 || other >= len(n.queue) {
+			return codeInvalidParameter, nil, nil
+		}
+		n.queue[index], n.queue[other] = n.queue[other], n.queue[index]
+	case "clear":
+		n.queue, n.queueNum = nil, -1
+	default:
+		return codeInvalidParameter, nil, nil
+	}
+	return codeOK, nil, map[string]interface{}{"netusb": map[string]interface{}{"play_queue": map[string]interface{}{"updated": true}}}
+}
+
+// play starts playing the given track and adds it to the recent items, with the server locked.
+func (s *Server) play(input, track string) (fragments map[string]interface{}) {
+	s.playback["input"] = input
+	s.playback["track"] = track
+	s.playback["playback"] = "play"
+	s.status["main"]["input"] = input
+
+	item := map[string]interface{}{"input": input, "text": track, "albumart_url": "", "play_count": 1, "attribute": attributePlayable}
+	recent := []map[string]interface{}{item}
+	for _, other := range s.netusb.recent {
+		if other["input"] == input && other["text"] == track {
+			item["play_count"] = other["play_count"].(int) + 1
+		} else if len(recent) < recentNum {
+			recent = append(recent, other)
+		}
+	}
+	s.netusb.recent = recent
+	return map[string]interface{}{
+		"main":   map[string]interface{}{"input": input},
+		"netusb": map[string]interface{}{"play_info_updated": true, "recent_updated": true},
+	}
+}
+
+// list returns the list currently browsed and its name.
+func (n *netusb) list() (items []ListItem, name string) {
+	items, name = n.lists[n.input], n.input
+	for _, i := range n.path {
+		items, name = items[i].Items, items[i].Text
+	}
+	return items, name
+}
+
+func (item ListItem) attribute() int {
+	if item.Items != nil {
+		return attributeSelectable
+	}
+	return attributePlayable
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,727 @@
+// Package musiccasttest provides a fake MusicCast device for testing.
+package musiccasttest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	upnp "github.com/huin/goupnp"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DeviceID    = "00A0DED12345"
+	ModelName   = "WX-030"
+	NetworkName = "Living Room"
+	MaxVolume   = 60
+)
+
+// YXC response codes.
+const (
+	codeOK               = 0
+	codeInvalidRequest   = 3
+	codeInvalidParameter = 4
+)
+
+const (
+	extendedControlPath = "/YamahaExtendedControl/v1/"
+	descriptionPath     = "/MediaRenderer/desc.xml"
+	avTransportPath     = "/AVTransport/ctrl"
+	avTransportType     = "urn:schemas-upnp-org:service:AVTransport:1"
+)
+
+// Transport is the UPnP AVTransport state of the server.
+type Transport struct {
+	URI      string
+	Metadata string
+	State    string
+}
+
+// image is an album art image served by the server.
+type image struct {
+	contentType string
+	data        []byte
+}
+
+// Server is a fake MusicCast device serving the YXC endpoints, a UPnP
+// description and an AVTransport control endpoint from memory. State changes
+// are sent as YXC events to the port announced in the X-AppPort header.
+type Server struct {
+	// URL is the base URL of the server, without trailing slash.
+	URL string
+
+	server       *httptest.Server
+	mutex        sync.Mutex
+	features     map[string]interface{}
+	status       map[string]map[string]interface{}
+	playback     map[string]interface{}
+	dist         map[string]interface{}
+	netusb       netusb
+	tuner        tuner
+	cd           map[string]interface{}
+	bluetooth    bluetooth
+	clock        map[string]interface{}
+	dateTime     string
+	distributing bool
+	transport    Transport
+	clip         time.Duration
+	images       map[string]image
+	eventAddr    *net.UDPAddr
+	silent       bool
+	failures     int
+	failWith     int
+	failPath     string
+	failCode     int
+	delay        time.Duration
+}
+
+// intSettings maps the zone setters taking a number to their parameter and status field.
+var intSettings = map[string][2]string{
+	"setSleep":           {"sleep", "sleep"},
+	"setBalance":         {"value", "balance"},
+	"setDialogueLevel":   {"value", "dialogue_level"},
+	"setSubwooferVolume": {"volume", "subwoofer_volume"},
+}
+
+// boolSettings maps the zone setters taking a boolean to their status field.
+var boolSettings = map[string]string{
+	"setMute":          "mute",
+	"setClearVoice":    "clear_voice",
+	"setBassExtension": "bass_extension",
+	"setEnhancer":      "enhancer",
+	"setPureDirect":    "pure_direct",
+	"setExtraBass":     "extra_bass",
+}
+
+// minDB is the volume in dB at volume step 0, each step adds 0.5 dB.
+const minDB = -80.5
+
+func dB(volume int) float64 {
+	return minDB + float64(volume)/2
+}
+
+func actualVolume(volume int) map[string]interface{} {
+	return map[string]interface{}{"mode": "db", "value": dB(volume), "unit": "dB"}
+}
+
+// NewServer starts a new Server with a single main zone on localhost.
+func NewServer() *Server {
+	s := &Server{
+		features: map[string]interface{}{
+			"system": map[string]interface{}{
+				"func_list": []string{"bluetooth_standby", "bluetooth_tx_setting"},
+				"zone_num":  1,
+				"input_list": []map[string]interface{}{
+					{"id": "net_radio", "distribution_enable": true, "play_info_type": "netusb"},
+					{"id": "spotify", "distribution_enable": true, "play_info_type": "netusb"},
+					{"id": "tuner", "distribution_enable": true, "play_info_type": "tuner"},
+					{"id": "cd", "distribution_enable": true, "play_info_type": "cd"},
+					{"id": "bluetooth", "distribution_enable": true, "play_info_type": "netusb"},
+					{"id": "aux", "distribution_enable": true, "play_info_type": "none"},
+				},
+			},
+			"zone": []map[string]interface{}{{
+				"id":                      "main",
+				"func_list":               []string{"power", "sleep", "volume", "mute", "sound_program", "balance", "subwoofer_volume", "clear_voice", "bass_extension", "extra_bass", "scene", "actual_volume"},
+				"input_list":              []string{"net_radio", "spotify", "tuner", "cd", "bluetooth", "aux"},
+				"sound_program_list":      []string{"stereo", "straight"},
+				"scene_num":               4,
+				"actual_volume_mode_list": []string{"db", "numeric"},
+				"range_step": []map[string]interface{}{
+					{"id": "volume", "min": 0, "max": MaxVolume, "step": 1},
+					{"id": "actual_volume_db", "min": minDB, "max": dB(MaxVolume), "step": 0.5},
+					{"id": "balance", "min": -12, "max": 12, "step": 1},
+					{"id": "subwoofer_volume", "min": -12, "max": 12, "step": 1},
+				},
+			}},
+			"distribution": map[string]interface{}{
+				"version":          2.0,
+				"client_max":       9,
+				"server_zone_list": []string{"main"},
+			},
+			"tuner": map[string]interface{}{
+				"func_list": []string{"am", "fm", "rds", "dab"},
+				"range_step": []map[string]interface{}{
+					{"id": "am", "min": MinAMFreq, "max": MaxAMFreq, "step": AMFreqStep},
+					{"id": "fm", "min": MinFMFreq, "max": MaxFMFreq, "step": FMFreqStep},
+				},
+				"preset": map[string]interface{}{"type": "common", "num": tunerPresetNum},
+			},
+			"clock": map[string]interface{}{
+				"func_list": []string{"date_and_time", "alarm"},
+				"range_step": []map[string]interface{}{
+					{"id": "alarm_volume", "min": 0, "max": MaxAlarmVolume, "step": 1},
+					{"id": "alarm_fade", "min": 0, "max": MaxAlarmFade, "step": 1},
+				},
+				"alarm_fade_type_num": 5,
+				"alarm_mode_list":     []string{"oneday", "weekly"},
+				"alarm_input_list":    []string{"net_radio", "tuner", "cd"},
+				"alarm_preset_list":   []string{"netusb", "tuner"},
+			},
+			"netusb": map[string]interface{}{
+				"func_list":   []string{"recent_info", "play_queue"},
+				"preset":      map[string]interface{}{"num": presetNum},
+				"recent_info": map[string]interface{}{"num": recentNum},
+				"play_queue":  map[string]interface{}{"size": queueSize},
+			},
+		},
+		status: map[string]map[string]interface{}{
+			"main": {
+				"power":            "standby",
+				"sleep":            0,
+				"volume":           20,
+				"mute":             false,
+				"max_volume":       MaxVolume,
+				"actual_volume":    actualVolume(20),
+				"input":            "net_radio",
+				"sound_program":    "stereo",
+				"balance":          0,
+				"subwoofer_volume": 0,
+				"clear_voice":      false,
+				"bass_extension":   false,
+				"extra_bass":       false,
+			},
+		},
+		playback: map[string]interface{}{
+			"input":        "net_radio",
+			"playback":     "stop",
+			"repeat":       "off",
+			"shuffle":      "off",
+			"play_time":    0,
+			"total_time":   0,
+			"artist":       "",
+			"album":        "",
+			"albumart_url": "",
+			"track":        "",
+		},
+		dist:      map[string]interface{}{"group_id": "", "group_name": "", "role": "none", "client_list": []interface{}{}},
+		netusb:    newNetUSB(),
+		tuner:     newTuner(),
+		cd:        newCD(),
+		clock:     newClock(),
+		transport: Transport{State: "NO_MEDIA_PRESENT"},
+		images:    make(map[string]image),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(extendedControlPath, s.serveExtendedControl)
+	mux.HandleFunc(descriptionPath, s.serveDescription)
+	mux.HandleFunc(avTransportPath, s.serveAVTransport)
+	mux.HandleFunc("/", s.serveAlbumArt)
+	s.server = httptest.NewServer(mux)
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Location returns the URL of the UPnP device description.
+func (s *Server) Location() *url.URL {
+	loc, _ := url.Parse(s.URL + descriptionPath)
+	return loc
+}
+
+// Root fetches the UPnP device description as returned by UPnP discovery.
+func (s *Server) Root() upnp.MaybeRootDevice {
+	loc := s.Location()
+	root, err := upnp.DeviceByURL(loc)
+	return upnp.MaybeRootDevice{Root: root, Location: loc, Err: err}
+}
+
+// Fail makes the next n YXC requests fail with the given HTTP status.
+func (s *Server) Fail(n, status int) {
+	s.FailPath("", n, status)
+}
+
+// FailResponse makes the next n YXC requests answer with the given response code.
+func (s *Server) FailResponse(n, code int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures = n
+	s.failWith = 0
+	s.failPath = ""
+	s.failCode = code
+}
+
+// FailPath makes the next n YXC requests to the given path, such as "main/getStatus",
+// fail with the given HTTP status. An empty path matches all requests. Album art is
+// failed with its absolute path, such as "/YamahaRemoteControl/AlbumART/AlbumART1.png".
+func (s *Server) FailPath(path string, n, status int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures = n
+	s.failWith = status
+	s.failPath = path
+	s.failCode = 0
+}
+
+// SetDelay delays every YXC response by the given duration.
+func (s *Server) SetDelay(delay time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.delay = delay
+}
+
+// Status returns a copy of the status of the given zone.
+func (s *Server) Status(zone string) map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	status := make(map[string]interface{})
+	for k, v := range s.status[zone] {
+		status[k] = v
+	}
+	return status
+}
+
+// SetStatus changes a status field of the given zone as if it was changed on
+// the device itself, and sends the matching event.
+func (s *Server) SetStatus(zone, key string, value interface{}) error {
+	s.mutex.Lock()
+	s.status[zone][key] = value
+	s.mutex.Unlock()
+	return s.SendEvent(map[string]interface{}{zone: map[string]interface{}{key: value}})
+}
+
+// Playback returns a copy of the Net/USB play info.
+func (s *Server) Playback() map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	playback := make(map[string]interface{})
+	for k, v := range s.playback {
+		playback[k] = v
+	}
+	return playback
+}
+
+// SetPlayback changes a Net/USB play info field and sends the matching event.
+func (s *Server) SetPlayback(key string, value interface{}) error {
+	s.mutex.Lock()
+	s.playback[key] = value
+	s.mutex.Unlock()
+	return s.SendEvent(map[string]interface{}{"netusb": map[string]interface{}{"play_info_updated": true}})
+}
+
+// SetAlbumArt serves the image at the given path, sets it as the Net/USB
+// album art and sends the matching event.
+func (s *Server) SetAlbumArt(path, contentType string, data []byte) error {
+	s.mutex.Lock()
+	s.images[path] = image{contentType, data}
+	s.mutex.Unlock()
+	return s.SetPlayback("albumart_url", path)
+}
+
+// Distribution returns a copy of the multi-room link state.
+func (s *Server) Distribution() map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	dist := make(map[string]interface{})
+	for k, v := range s.dist {
+		dist[k] = v
+	}
+	return dist
+}
+
+// Distributing reports whether the multi-room link distribution is started.
+func (s *Server) Distributing() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.distributing
+}
+
+// Transport returns the AVTransport state.
+func (s *Server) Transport() Transport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.transport
+}
+
+// SetTransport changes the AVTransport state as if it was changed on the device itself.
+func (s *Server) SetTransport(transport Transport) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.transport = transport
+}
+
+// SetClipDuration makes the media started with Play stop after the given duration.
+// The default of 0 plays forever.
+func (s *Server) SetClipDuration(clip time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.clip = clip
+}
+
+// SetSilent drops the events sent afterwards, as a device whose subscription expired.
+func (s *Server) SetSilent(silent bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.silent = silent
+}
+
+// SendEvent sends the given event fragments to the last announced X-AppPort.
+// Events are dropped until a request announced the port and while the server is silent.
+func (s *Server) SendEvent(fragments map[string]interface{}) (err error) {
+	s.mutex.Lock()
+	addr, silent := s.eventAddr, s.silent
+	s.mutex.Unlock()
+	if addr == nil || silent {
+		return nil
+	}
+
+	e := map[string]interface{}{"device_id": DeviceID}
+	for k, v := range fragments {
+		e[k] = v
+	}
+	data, err := json.Marshal(e)
+	if err == nil {
+		var conn *net.UDPConn
+		conn, err = net.DialUDP("udp", nil, addr)
+		if err == nil {
+			defer conn.Close()
+			_, err = conn.Write(data)
+		}
+	}
+
+	return err
+}
+
+func (s *Server) serveExtendedControl(w http.ResponseWriter, r *http.Request) {
+	s.announce(r)
+	p := strings.TrimPrefix(r.URL.Path, extendedControlPath)
+	s.mutex.Lock()
+	delay, fail, status, failCode := s.delay, s.failures > 0 && (s.failPath == "" || s.failPath == p), s.failWith, s.failCode
+	if fail {
+		s.failures--
+	}
+	s.mutex.Unlock()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if fail && status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if fail {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"response_code":%d}`, failCode)
+		return
+	}
+
+	params := r.URL.Query()
+	var code int
+	var data map[string]interface{}
+	var fragments map[string]interface{}
+
+	s.mutex.Lock()
+	switch i := strings.Index(p, "/"); {
+	case p == "system/getDeviceInfo":
+		data = map[string]interface{}{"device_id": DeviceID, "model_name": ModelName, "system_version": 1.0, "api_version": 2.0}
+	case p == "system/getNetworkStatus":
+		data = map[string]interface{}{"network_name": NetworkName, "connection": "wired"}
+	case p == "system/getFeatures":
+		data = s.features
+	case strings.HasPrefix(p, "system/") && strings.Contains(p, "Bluetooth"):
+		code, data, fragments = s.bluetoothRequest(strings.TrimPrefix(p, "system/"), params)
+	case strings.HasPrefix(p, "clock/"):
+		code, data, fragments = s.clockRequest(strings.TrimPrefix(p, "clock/"), r)
+	case strings.HasPrefix(p, "cd/"):
+		code, data, fragments = s.cdRequest(strings.TrimPrefix(p, "cd/"), params)
+	case strings.HasPrefix(p, "tuner/"):
+		code, data, fragments = s.tunerRequest(strings.TrimPrefix(p, "tuner/"), params)
+	case strings.HasPrefix(p, "netusb/"):
+		code, data, fragments = s.netusbRequest(strings.TrimPrefix(p, "netusb/"), params)
+	case strings.HasPrefix(p, "dist/"):
+		code = s.distRequest(strings.TrimPrefix(p, "dist/"), r)
+		if p == "dist/getDistributionInfo" {
+			data = s.dist
+		}
+	case i > 0 && s.status[p[:i]] != nil:
+		code, data, fragments = s.zoneRequest(p[:i], p[i+1:], params)
+	default:
+		code = codeInvalidRequest
+	}
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	response := map[string]interface{}{"response_code": code}
+	for k, v := range data {
+		response[k] = v
+	}
+	body, err := json.Marshal(response)
+	s.mutex.Unlock()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+	if fragments != nil {
+		s.SendEvent(fragments)
+	}
+}
+
+// distRequest handles the multi-room link requests, with the server locked.
+func (s *Server) distRequest(method string, r *http.Request) (code int) {
+	var body map[string]interface{}
+	if r.Method == "POST" {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return codeInvalidParameter
+		}
+	}
+	switch method {
+	case "getDistributionInfo":
+	case "startDistribution":
+		s.distributing = true
+	case "stopDistribution":
+		s.distributing = false
+	case "setClientInfo":
+		s.dist["group_id"] = body["group_id"]
+		s.dist["role"] = "client"
+		if body["group_id"] == "" {
+			s.dist["role"] = "none"
+		}
+	case "setServerInfo":
+		clients, ok := body["client_list"].([]interface{})
+		if !ok {
+			return codeInvalidParameter
+		}
+		s.dist["group_id"] = body["group_id"]
+		s.dist["role"] = "server"
+		if body["group_id"] == "" || body["type"] == "remove" {
+			s.dist["role"] = "none"
+		}
+		s.dist["client_list"] = clients
+	case "setGroupName":
+		s.dist["group_name"] = body["name"]
+	default:
+		return codeInvalidRequest
+	}
+	return codeOK
+}
+
+// zoneRequest handles the requests to a zone, with the server locked.
+func (s *Server) zoneRequest(zone, method string, params url.Values) (code int, data map[string]interface{}, fragments map[string]interface{}) {
+	status := s.status[zone]
+	changes := make(map[string]interface{})
+	switch method {
+	case "getStatus":
+		return codeOK, status, nil
+	case "setPower":
+		power := params.Get("power")
+		if power == "toggle" {
+			power = map[bool]string{true: "standby", false: "on"}[status["power"] == "on"]
+		}
+		if power != "on" && power != "standby" {
+			return codeInvalidParameter, nil, nil
+		}
+		changes["power"] = power
+	case "setVolume":
+		volume := status["volume"].(int)
+		step, err := strconv.Atoi(params.Get("step"))
+		if err != nil {
+			step = 1
+		}
+		switch v := params.Get("volume"); v {
+		case "up":
+			volume += step
+		case "down":
+			volume -= step
+		default:
+			if volume, err = strconv.Atoi(v); err != nil {
+				return codeInvalidParameter, nil, nil
+			}
+		}
+		if volume < 0 || volume > MaxVolume {
+			return codeInvalidParameter, nil, nil
+		}
+		changes["volume"] = volume
+		changes["actual_volume"] = actualVolume(volume)
+	case "setActualVolume":
+		value, err := strconv.ParseFloat(params.Get("value"), 64)
+		if err != nil || params.Get("mode") != "db" || value < minDB || value > dB(MaxVolume) {
+			return codeInvalidParameter, nil, nil
+		}
+		volume := int((value - minDB) * 2)
+		changes["volume"] = volume
+		changes["actual_volume"] = actualVolume(volume)
+	case "setInput":
+		changes["input"] = params.Get("input")
+	case "setSoundProgram":
+		changes["sound_program"] = params.Get("program")
+	case "recallScene":
+		num, err := strconv.Atoi(params.Get("num"))
+		if err != nil || num < 1 || num > 4 {
+			return codeInvalidParameter, nil, nil
+		}
+		changes["power"] = "on"
+		changes["input"] = "aux"
+	default:
+		if setting, ok := intSettings[method]; ok {
+			v, err := strconv.Atoi(params.Get(setting[0]))
+			if err != nil {
+				return codeInvalidParameter, nil, nil
+			}
+			changes[setting[1]] = v
+		} else if field, ok := boolSettings[method]; ok {
+			v, err := strconv.ParseBool(params.Get("enable"))
+			if err != nil {
+				return codeInvalidParameter, nil, nil
+			}
+			changes[field] = v
+		} else {
+			return codeInvalidRequest, nil, nil
+		}
+	}
+
+	for k, v := range changes {
+		status[k] = v
+	}
+	return codeOK, nil, map[string]interface{}{zone: changes}
+}
+
+// setPlayback handles netusb/setPlayback, with the server locked.
+func (s *Server) setPlayback(playback string) (code int, fragments map[string]interface{}) {
+	switch playback {
+	case "play", "pause", "stop":
+	case "play_pause":
+		playback = map[bool]string{true: "pause", false: "play"}[s.playback["playback"] == "play"]
+	case "next", "previous":
+		playback = "play"
+	default:
+		return codeInvalidParameter, nil
+	}
+	s.playback["playback"] = playback
+	return codeOK, map[string]interface{}{"netusb": map[string]interface{}{"play_info_updated": true}}
+}
+
+// announce remembers the event port announced by the request.
+func (s *Server) announce(r *http.Request) {
+	port, err := strconv.Atoi(r.Header.Get("X-AppPort"))
+	if err != nil {
+		return
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return
+	}
+	s.mutex.Lock()
+	s.eventAddr = &net.UDPAddr{IP: net.ParseIP(host), Port: port}
+	s.mutex.Unlock()
+}
+
+func (s *Server) serveDescription(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:MediaRenderer:1</deviceType>
+    <friendlyName>%s</friendlyName>
+    <manufacturer>Yamaha Corporation</manufacturer>
+    <modelName>%s</modelName>
+    <UDN>uuid:9ab0c000-f668-11de-9976-%s</UDN>
+    <presentationURL>/</presentationURL>
+    <serviceList>
+      <service>
+        <serviceType>%s</serviceType>
+        <serviceId>urn:upnp-org:serviceId:AVTransport</serviceId>
+        <SCPDURL>/AVTransport/desc.xml</SCPDURL>
+        <controlURL>%s</controlURL>
+        <eventSubURL>/AVTransport/event</eventSubURL>
+      </service>
+    </serviceList>
+  </device>
+</root>`, NetworkName, ModelName, strings.ToLower(DeviceID), avTransportType, avTransportPath)
+}
+
+func (s *Server) serveAlbumArt(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	img, ok := s.images[r.URL.Path]
+	fail, status := s.failures > 0 && s.failPath == r.URL.Path, s.failWith
+	if fail {
+		s.failures--
+	}
+	s.mutex.Unlock()
+	if fail && status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", img.contentType)
+	w.Write(img.data)
+}
+
+func (s *Server) serveAVTransport(w http.ResponseWriter, r *http.Request) {
+	action := strings.Trim(r.Header.Get("SOAPACTION"), `"`)
+	action = action[strings.LastIndex(action, "#")+1:]
+
+	var envelope struct {
+		Body struct {
+			Action struct {
+				CurrentURI         string
+				CurrentURIMetaData string
+			} `xml:",any"`
+		}
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mutex.Lock()
+	args := ""
+	switch action {
+	case "SetAVTransportURI":
+		s.transport = Transport{envelope.Body.Action.CurrentURI, envelope.Body.Action.CurrentURIMetaData, "STOPPED"}
+	case "Play":
+		s.transport.State = "PLAYING"
+		if s.clip > 0 {
+			uri := s.transport.URI
+			time.AfterFunc(s.clip, func() {
+				s.mutex.Lock()
+				defer s.mutex.Unlock()
+				if s.transport.URI == uri {
+					s.transport.State = "STOPPED"
+				}
+			})
+		}
+	case "Pause":
+		s.transport.State = "PAUSED_PLAYBACK"
+	case "Stop":
+		s.transport.State = "STOPPED"
+	case "GetTransportInfo":
+		args = fmt.Sprintf("<CurrentTransportState>%s</CurrentTransportState><CurrentTransportStatus>OK</CurrentTransportStatus><CurrentSpeed>1</CurrentSpeed>", s.transport.State)
+	case "GetPositionInfo":
+		var uri strings.Builder
+		xml.EscapeText(&uri, []byte(s.transport.URI))
+		args = fmt.Sprintf("<Track>1</Track><TrackDuration>0:00:10</TrackDuration><TrackMetaData></TrackMetaData><TrackURI>%s</TrackURI>"+
+			"<RelTime>0:00:00</RelTime><AbsTime>NOT_IMPLEMENTED</AbsTime><RelCount>0</RelCount><AbsCount>0</AbsCount>", uri.String())
+	default:
+		s.mutex.Unlock()
+		http.Error(w, "invalid action "+action, http.StatusInternalServerError)
+		return
+	}
+	s.mutex.Unlock()
+
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	fmt.Fprintf(w, `<?xml version="1.0"?>`+
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">`+
+		`<s:Body><u:%sResponse xmlns:u="%s">%s</u:%sResponse></s:Body></s:Envelope>`, action, avTransportType, args, action)
+}
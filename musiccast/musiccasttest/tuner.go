@@ -0,0 +1,189 @@
+package musiccasttest
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// Tuner frequency ranges in kHz.
+const (
+	MinAMFreq  = 531
+	MaxAMFreq  = 1611
+	AMFreqStep = 9
+	MinFMFreq  = 87500
+	MaxFMFreq  = 108000
+	FMFreqStep = 50
+)
+
+const tunerPresetNum = 40
+
+// DABServices are the DAB services received by the tuner.
+var DABServices = []string{"Radio 1", "Radio 2", "Radio 3"}
+
+// tuner is the FM/AM/DAB tuner state of the server.
+type tuner struct {
+	band    string
+	freq    map[string]int
+	dab     int
+	presets []map[string]interface{}
+}
+
+func newTuner() tuner {
+	t := tuner{band: "fm", freq: map[string]int{"am": MinAMFreq, "fm": MinFMFreq}}
+	for i := 0; i < tunerPresetNum; i++ {
+		t.presets = append(t.presets, map[string]interface{}{"band": "unknown", "number": 0, "text": ""})
+	}
+	return t
+}
+
+// tunerRequest handles the tuner/* requests, with the server locked.
+func (s *Server) tunerRequest(method string, params url.Values) (code int, data map[string]interface{}, fragments map[string]interface{}) {
+	t := &s.tuner
+	updated := map[string]interface{}{"tuner": map[string]interface{}{"play_info_updated": true}}
+	switch method {
+	case "getPlayInfo":
+		return codeOK, t.playInfo(), nil
+	case "getPresetInfo":
+		if params.Get("band") != "common" {
+			return codeInvalidParameter, nil, nil
+		}
+		return codeOK, map[string]interface{}{"preset_info": t.presets}, nil
+	case "setBand":
+		band := params.Get("band")
+		if band != "am" && band != "fm" && band != "dab" {
+			return codeInvalidParameter, nil, nil
+		}
+		t.band = band
+		return codeOK, nil, updated
+	case "setFreq":
+		band := params.Get("band")
+		low, high, step, ok := freqRange(band)
+		if !ok {
+			return codeInvalidParameter, nil, nil
+		}
+		freq := t.freq[band]
+		switch params.Get("tuning") {
+		case "direct":
+			var err error
+			if freq, err = strconv.Atoi(params.Get("num")); err != nil || (freq-low)%step != 0 {
+				return codeInvalidParameter, nil, nil
+			}
+		case "up", "auto_up":
+			freq += step
+		case "down", "auto_down":
+			freq -= step
+		case "cancel":
+		default:
+			return codeInvalidParameter, nil, nil
+		}
+		if freq < low || freq > high {
+			return codeInvalidParameter, nil, nil
+		}
+		t.band, t.freq[band] = band, freq
+		return codeOK, nil, updated
+	case "setDabService":
+		switch params.Get("dir") {
+		case "next":
+			t.dab = (t.dab + 1) % len(DABServices)
+		case "previous":
+			t.dab = (t.dab + len(DABServices) - 1) % len(DABServices)
+		default:
+			return codeInvalidParameter, nil, nil
+		}
+		return codeOK, nil, updated
+	case "storePreset":
+		num, err := strconv.Atoi(params.Get("num"))
+		if err != nil || num < 1 || num > len(t.presets) {
+			return codeInvalidParameter, nil, nil
+		}
+		preset := map[string]interface{}{"band": t.band, "number": t.freq[t.band], "text": ""}
+		if t.band == "dab" {
+			preset["number"], preset["text"] = t.dab, DABServices[t.dab]
+		}
+		t.presets[num-1] = preset
+		return codeOK, nil, map[string]interface{}{"tuner": map[string]interface{}{"preset_info_updated": true}}
+	case "recallPreset":
+		num, err := strconv.Atoi(params.Get("num"))
+		if err != nil || num < 1 || num > len(t.presets) || t.presets[num-1]["band"] == "unknown" {
+			return codeInvalidParameter, nil, nil
+		}
+		t.recall(num - 1)
+		return codeOK, nil, updated
+	case "switchPreset":
+		dir := 1
+		switch params.Get("dir") {
+		case "next":
+		case "previous":
+			dir = -1
+		default:
+			return codeInvalidParameter, nil, nil
+		}
+		current := t.currentPreset()
+		for i := 1; i <= len(t.presets); i++ {
+			n := ((current+dir*i)%len(t.presets) + len(t.presets)) % len(t.presets)
+			if t.presets[n]["band"] != "unknown" {
+				t.recall(n)
+				return codeOK, nil, updated
+			}
+		}
+		return codeInvalidRequest, nil, nil
+	}
+	return codeInvalidRequest, nil, nil
+}
+
+func (t *tuner) playInfo() map[string]interface{} {
+	preset := func(band string) int {
+		if current := t.currentPreset(); current >= 0 && t.presets[current]["band"] == band {
+			return current + 1
+		}
+		return 0
+	}
+	return map[string]interface{}{
+		"band":        t.band,
+		"auto_scan":   false,
+		"auto_preset": false,
+		"am":          map[string]interface{}{"preset": preset("am"), "freq": t.freq["am"], "tuned": true},
+		"fm":          map[string]interface{}{"preset": preset("fm"), "freq": t.freq["fm"], "tuned": true, "audio_mode": "stereo"},
+		"rds":         map[string]interface{}{"program_type": "", "program_service": "", "radio_text_a": "", "radio_text_b": ""},
+		"dab": map[string]interface{}{
+			"preset":        preset("dab"),
+			"id":            t.dab,
+			"status":        "ready",
+			"service_label": DABServices[t.dab],
+		},
+	}
+}
+
+// currentPreset returns the index of the preset of the current station, or -1.
+func (t *tuner) currentPreset() int {
+	number := t.freq[t.band]
+	if t.band == "dab" {
+		number = t.dab
+	}
+	for i, preset := range t.presets {
+		if preset["band"] == t.band && preset["number"] == number {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *tuner) recall(i int) {
+	preset := t.presets[i]
+	t.band = preset["band"].(string)
+	if t.band == "dab" {
+		t.dab = preset["number"].(int)
+	} else {
+		t.freq[t.band] = preset["number"].(int)
+	}
+}
+
+func freqRange(band string) (low, high, step int, ok bool) {
+	switch band {
+	case "am":
+		return MinAMFreq, MaxAMFreq, AMFreqStep, true
+	case "fm":
+		return MinFMFreq, MaxFMFreq, FMFreqStep, true
+	}
+	return 0, 0, 0, false
+}
@@ -0,0 +1,367 @@
+package musiccast
+
+import (
+	"fmt"
+	"github.com/cskr/pubsub"
+	upnp "github.com/huin/goupnp"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultDiscoveryInterval = time.Minute
+	DefaultDeviceTimeout     = 5 * time.Minute
+)
+
+const (
+	DeviceAdded   = "added"
+	DeviceRemoved = "removed"
+	DeviceChanged = "changed"
+)
+
+// RegistryEvent notifies that a device was added to, removed from or changed in a Registry.
+type RegistryEvent struct {
+	Type   string
+	Device *Device
+}
+
+// Registry keeps track of the available devices, discovering new ones and
+// dropping those that went away.
+type Registry struct {
+	// Hosts are loaded in addition to the devices discovered with UPnP.
+	Hosts []string
+	// DiscoveryInterval is the time between two discoveries.
+	DiscoveryInterval time.Duration
+	// Timeout is how long a device may neither be discovered, send events nor
+	// answer requests before it is removed.
+	Timeout time.Duration
+	// OnError is called for every discovery and probing error.
+	OnError func(err error)
+
+	devices  map[string]*Device
+	lastSeen map[string]time.Time
+	appPort  int
+	events   *pubsub.PubSub
+	done     chan struct{}
+	wg       sync.WaitGroup
+	mutex    sync.RWMutex
+}
+
+// DefaultRegistry is the registry used by Discover, LoadDevices and listeners without a registry.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry creates a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		DiscoveryInterval: DefaultDiscoveryInterval,
+		Timeout:           DefaultDeviceTimeout,
+		devices:           make(map[string]*Device),
+		lastSeen:          make(map[string]time.Time),
+		appPort:           DefaultAppPort,
+		events:            pubsub.New(1),
+	}
+}
+
+// Get returns the device with the given id, or nil if it is not registered.
+func (r *Registry) Get(deviceID string) *Device {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.devices[deviceID]
+}
+
+// Devices returns the registered devices ordered by id.
+func (r *Registry) Devices() (devices []*Device) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	ids := make([]string, 0, len(r.devices))
+	for id := range r.devices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		devices = append(devices, r.devices[id])
+	}
+	return devices
+}
+
+// Add registers the given device and returns the registered one. A device already
+// registered under the same id keeps its identity and takes over the address of the
+// given one, unless both descriptions are served from the same host and port.
+func (r *Registry) Add(d *Device) *Device {
+	id := d.GetDeviceID()
+	r.mutex.Lock()
+	existing := r.devices[id]
+	if existing == nil {
+		r.devices[id] = d
+		d.SetAppPort(r.appPort)
+	}
+	r.lastSeen[id] = time.Now()
+	r.mutex.Unlock()
+
+	if existing == nil {
+		r.events.Pub(RegistryEvent{DeviceAdded, d}, "registry")
+		return d
+	}
+	if existing != d && !sameLocation(existing.location(), d.location()) {
+		existing.relocate(d)
+		if err := existing.resync(); err != nil {
+			r.reportError(err)
+		}
+		r.events.Pub(RegistryEvent{DeviceChanged, existing}, "registry")
+	}
+	return existing
+}
+
+// Remove unregisters the device with the given id.
+func (r *Registry) Remove(deviceID string) {
+	r.mutex.Lock()
+	d := r.devices[deviceID]
+	delete(r.devices, deviceID)
+	delete(r.lastSeen, deviceID)
+	r.mutex.Unlock()
+
+	if d != nil {
+		d.StopKeepAlive()
+		r.events.Pub(RegistryEvent{DeviceRemoved, d}, "registry")
+	}
+}
+
+// Subscribe returns a channel receiving a RegistryEvent for every added, removed or changed device.
+func (r *Registry) Subscribe() chan interface{} {
+	return r.events.Sub("registry")
+}
+
+// Refresh discovers devices once, registers the new ones and removes those
+// that have timed out.
+func (r *Registry) Refresh() (err error) {
+	seen := make(map[string]bool)
+	// registered devices are looked up by the address of their description, as
+	// some renderers have no presentation URL
+	hosts := make(map[string]*Device)
+	for _, d := range r.Devices() {
+		for _, addr := range addresses(d.location()) {
+			hosts[addr] = d
+		}
+	}
+	lookup := func(location *url.URL) *Device {
+		for _, addr := range addresses(location) {
+			if d := hosts[addr]; d != nil {
+				return d
+			}
+		}
+		return nil
+	}
+
+	maybeRootDevices, err := upnp.DiscoverDevices("urn:schemas-upnp-org:device:MediaRenderer:1")
+	if err != nil {
+		r.reportError(err)
+	}
+	for _, maybeRoot := range maybeRootDevices {
+		if maybeRoot.Err != nil {
+			continue
+		}
+		if d := lookup(maybeRoot.Location); d != nil {
+			seen[d.GetDeviceID()] = true
+			continue
+		}
+		d, e := NewDevice(maybeRoot)
+		if e != nil {
+			r.reportError(e)
+			continue
+		}
+		r.Add(d)
+		seen[d.GetDeviceID()] = true
+	}
+
+	for _, host := range r.Hosts {
+		_, location := hostURLs(host)
+		if d := lookup(location); d != nil {
+			seen[d.GetDeviceID()] = true
+			continue
+		}
+		d, e := NewDeviceFromHost(host)
+		if e != nil {
+			r.reportError(fmt.Errorf("%s: %v", host, e))
+			continue
+		}
+		r.Add(d)
+		seen[d.GetDeviceID()] = true
+	}
+
+	r.expire(seen)
+	return err
+}
+
+// Start discovers devices every DiscoveryInterval until Stop is called.
+func (r *Registry) Start() (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.done != nil {
+		return fmt.Errorf("registry already started")
+	}
+
+	interval := r.DiscoveryInterval
+	if interval <= 0 {
+		interval = DefaultDiscoveryInterval
+	}
+	done := make(chan struct{})
+	r.done = done
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			r.Refresh()
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return err
+}
+
+// Stop stops discovering devices.
+func (r *Registry) Stop() (err error) {
+	r.mutex.Lock()
+	done := r.done
+	r.done = nil
+	r.mutex.Unlock()
+	if done == nil {
+		return fmt.Errorf("registry not started")
+	}
+
+	close(done)
+	r.wg.Wait()
+	return err
+}
+
+// expire probes the devices not seen by the last discovery and removes those
+// that have timed out.
+func (r *Registry) expire(seen map[string]bool) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultDeviceTimeout
+	}
+
+	for _, d := range r.Devices() {
+		id := d.GetDeviceID()
+		alive := seen[id]
+		if !alive {
+			if err := d.probe(); err != nil {
+				r.reportError(err)
+			} else {
+				alive = true
+			}
+		}
+
+		r.mutex.Lock()
+		lastSeen := r.lastSeen[id]
+		if alive {
+			lastSeen = time.Now()
+		} else if lastEvent := d.LastEvent(); lastEvent.After(lastSeen) {
+			lastSeen = lastEvent
+		}
+		r.lastSeen[id] = lastSeen
+		r.mutex.Unlock()
+
+		if time.Since(lastSeen) >= timeout {
+			r.Remove(id)
+		}
+	}
+}
+
+// setAppPort tells the registered devices, and those added later, to send their events to the given port.
+func (r *Registry) setAppPort(port int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.appPort = port
+	for _, d := range r.devices {
+		d.SetAppPort(port)
+	}
+}
+
+// releaseAppPort disables events once the listener on the given port stopped, unless another one took over.
+func (r *Registry) releaseAppPort(port int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.appPort == port {
+		r.appPort = 0
+		for _, d := range r.devices {
+			d.SetAppPort(0)
+		}
+	}
+}
+
+// resolve returns the addresses of the given host, or the host itself if it cannot be resolved.
+func resolve(host string) []string {
+	if net.ParseIP(host) != nil {
+		return []string{host}
+	}
+	addrs, err := net.LookupHost(host)
+	if err != nil || len(addrs) == 0 {
+		return []string{host}
+	}
+	return addrs
+}
+
+// addresses returns the resolved addresses of the host of the given URL, with its port.
+func addresses(u *url.URL) (addrs []string) {
+	if u == nil {
+		return nil
+	}
+	for _, addr := range resolve(u.Hostname()) {
+		addrs = append(addrs, net.JoinHostPort(addr, u.Port()))
+	}
+	return addrs
+}
+
+// sameLocation reports whether the given URLs have the same port and hosts resolving to a common address.
+func sameLocation(a, b *url.URL) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Port() == b.Port() && sameHost(a.Hostname(), b.Hostname())
+}
+
+// sameHost reports whether the given host names or addresses resolve to a common address.
+func sameHost(a, b string) bool {
+	if a == b {
+		return true
+	}
+	for _, x := range resolve(a) {
+		for _, y := range resolve(b) {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *Registry) reportError(err error) {
+	if r.OnError != nil {
+		r.OnError(err)
+	}
+}
+
+// relocate moves the device to the address of the given device, which has the same id.
+func (d *Device) relocate(moved *Device) {
+	moved.endpoint.mutex.RLock()
+	baseURL := moved.endpoint.extendedControlBaseURL
+	location := moved.endpoint.location
+	avTransport := moved.endpoint.avTransport
+	moved.endpoint.mutex.RUnlock()
+
+	d.endpoint.mutex.Lock()
+	d.endpoint.extendedControlBaseURL = baseURL
+	d.endpoint.location = location
+	d.endpoint.avTransport = avTransport
+	d.endpoint.mutex.Unlock()
+}
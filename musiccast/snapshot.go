@@ -0,0 +1,163 @@
+package musiccast
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Snapshot is the restorable state of a device. Its JSON encoding is a subset
+// of the device JSON encoding, which can be decoded as a Snapshot.
+type Snapshot struct {
+	DeviceID string                  `json:"id"`
+	Zones    map[string]ZoneSnapshot `json:"zones"`
+	Playback PlaybackSnapshot        `json:"playback"`
+}
+
+// ZoneSnapshot is the restorable state of a zone.
+type ZoneSnapshot struct {
+	Power        string `json:"power"`
+	Input        string `json:"input"`
+	Volume       uint8  `json:"volume"`
+	Mute         bool   `json:"mute"`
+	SoundProgram string `json:"sound_program,omitempty"`
+}
+
+// PlaybackSnapshot is the restorable Net/USB playback state.
+type PlaybackSnapshot struct {
+	Input    string `json:"input"`
+	Playback string `json:"playback"`
+	PlayTime int32  `json:"play_time"`
+}
+
+// RecallScene recalls the scene with the given number, starting at 1.
+func (z *Zone) RecallScene(num int) (err error) {
+	zf, err := z.require("scene")
+	if err == nil {
+		if num < 1 || (zf.SceneNum > 0 && num > zf.SceneNum) {
+			err = fmt.Errorf("invalid scene %d", num)
+		} else {
+			params := map[string]interface{}{"num": num}
+			err = z.call("recallScene", params)
+		}
+	}
+
+	return err
+}
+
+// RecallScene recalls the main zone scene with the given number, starting at 1.
+func (d *Device) RecallScene(num int) (err error) {
+	return d.zone(MainZone).RecallScene(num)
+}
+
+// Snapshot returns the current restorable state of the device.
+func (d *Device) Snapshot() Snapshot {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	s := Snapshot{DeviceID: d.id, Zones: make(map[string]ZoneSnapshot)}
+	for id, status := range d.state.Zones {
+		s.Zones[id] = ZoneSnapshot{status.Power, status.Input, status.Volume, status.Mute, status.SoundProgram}
+	}
+	s.Playback = PlaybackSnapshot{d.state.Playback.Input, d.state.Playback.Playback, d.state.Playback.PlayTime}
+	return s
+}
+
+// Restore restores the state of the given snapshot of the device.
+func (d *Device) Restore(s Snapshot) (err error) {
+	if s.DeviceID != d.GetDeviceID() {
+		return fmt.Errorf("snapshot of device %s cannot be restored on %s", s.DeviceID, d.GetDeviceID())
+	}
+	for id, zs := range s.Zones {
+		z := d.Zone(id)
+		if z == nil {
+			return fmt.Errorf("unknown zone %s", id)
+		}
+		if err = z.restore(zs); err != nil {
+			return err
+		}
+	}
+	if main, ok := s.Zones[MainZone]; ok && main.Power == PowerOn {
+		err = d.restorePlayback(s.Playback, main.Input)
+	}
+	for id, zs := range s.Zones {
+		if err == nil && zs.Power != PowerOn && zs.Power != "" {
+			err = d.zone(id).SetPower(zs.Power)
+		}
+	}
+
+	return err
+}
+
+// TakeSnapshots returns the snapshots of all the given devices.
+func TakeSnapshots(devices []*Device) (snapshots []Snapshot) {
+	for _, d := range devices {
+		snapshots = append(snapshots, d.Snapshot())
+	}
+	return snapshots
+}
+
+// RestoreSnapshots restores the snapshots on all the given devices at once.
+// Snapshots of devices missing from the list are skipped.
+func RestoreSnapshots(devices []*Device, snapshots []Snapshot) (err error) {
+	var wg sync.WaitGroup
+	errs := make([]error, len(devices))
+	for i, d := range devices {
+		for _, s := range snapshots {
+			if s.DeviceID == d.GetDeviceID() {
+				wg.Add(1)
+				go func(i int, d *Device, s Snapshot) {
+					defer wg.Done()
+					errs[i] = d.Restore(s)
+				}(i, d, s)
+			}
+		}
+	}
+	wg.Wait()
+
+	for i, e := range errs {
+		if e != nil {
+			return fmt.Errorf("%s: %v", devices[i].GetNetworkName(), e)
+		}
+	}
+	return nil
+}
+
+// restore restores the zone state except for standby, which is set once playback has been restored.
+func (z *Zone) restore(s ZoneSnapshot) (err error) {
+	zf, _ := z.features()
+	if s.Power == PowerOn && z.GetStatus().Power != PowerOn {
+		err = z.SetPower(PowerOn)
+	}
+	if err == nil && s.Input != "" {
+		err = z.SetInput(s.Input)
+	}
+	if err == nil && zf.HasFunc("volume") {
+		err = z.SetVolume(s.Volume)
+	}
+	if err == nil && zf.HasFunc("mute") {
+		err = z.SetMute(s.Mute)
+	}
+	if err == nil && s.SoundProgram != "" && zf.HasFunc("sound_program") {
+		err = z.SetSoundProgram(s.SoundProgram)
+	}
+
+	return err
+}
+
+// restorePlayback resumes Net/USB playback if it was playing from the given input.
+func (d *Device) restorePlayback(s PlaybackSnapshot, input string) (err error) {
+	if s.Playback != "play" || s.Input != input || d.GetFeatures().NetUSB == nil {
+		return nil
+	}
+	err = d.Play()
+	if err == nil && s.PlayTime > 0 && contains(d.GetFeatures().NetUSB.FuncList, "play_position") {
+		params := map[string]interface{}{"position": s.PlayTime}
+		var resp *http.Response
+		resp, err = d.requestWithParams("GET", "netusb/setPlayPosition", params)
+		if err == nil {
+			_, err = decodeResponse(resp)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,129 @@
+package musiccast
+
+import (
+	"fmt"
+)
+
+// ToneControl is the bass and treble setting of a zone.
+type ToneControl struct {
+	Mode   string `json:"mode"`
+	Bass   int8   `json:"bass"`
+	Treble int8   `json:"treble"`
+}
+
+// Equalizer is the three band equalizer setting of a zone.
+type Equalizer struct {
+	Mode string `json:"mode"`
+	Low  int8   `json:"low"`
+	Mid  int8   `json:"mid"`
+	High int8   `json:"high"`
+}
+
+// SetToneControl sets the tone control mode and the bass and treble levels.
+// An empty mode keeps the current one.
+func (z *Zone) SetToneControl(mode string, bass, treble int8) (err error) {
+	zf, err := z.require("tone_control")
+	if err != nil {
+		return err
+	}
+	params := map[string]interface{}{"bass": bass, "treble": treble}
+	if mode != "" {
+		if len(zf.ToneControlModeList) > 0 && !contains(zf.ToneControlModeList, mode) {
+			return unsupported(fmt.Sprintf("tone control mode %s in zone %s", mode, z.id))
+		}
+		params["mode"] = mode
+	}
+	for _, v := range []int8{bass, treble} {
+		if err = z.checkRange("tone_control", float64(v)); err != nil {
+			return err
+		}
+	}
+	return z.call("setToneControl", params)
+}
+
+// SetEqualizer sets the equalizer mode and the low, mid and high levels.
+// An empty mode keeps the current one.
+func (z *Zone) SetEqualizer(mode string, low, mid, high int8) (err error) {
+	zf, err := z.require("equalizer")
+	if err != nil {
+		return err
+	}
+	params := map[string]interface{}{"low": low, "mid": mid, "high": high}
+	if mode != "" {
+		if len(zf.EqualizerModeList) > 0 && !contains(zf.EqualizerModeList, mode) {
+			return unsupported(fmt.Sprintf("equalizer mode %s in zone %s", mode, z.id))
+		}
+		params["mode"] = mode
+	}
+	for _, v := range []int8{low, mid, high} {
+		if err = z.checkRange("equalizer", float64(v)); err != nil {
+			return err
+		}
+	}
+	return z.call("setEqualizer", params)
+}
+
+// SetBalance sets the left/right balance, negative values shift it to the left.
+func (z *Zone) SetBalance(balance int8) (err error) {
+	return z.setLevel("balance", "setBalance", "value", balance)
+}
+
+// SetDialogueLevel sets the dialogue level.
+func (z *Zone) SetDialogueLevel(level int8) (err error) {
+	return z.setLevel("dialogue_level", "setDialogueLevel", "value", level)
+}
+
+// SetDialogueLift sets the height of the dialogue position.
+func (z *Zone) SetDialogueLift(lift int8) (err error) {
+	return z.setLevel("dialogue_lift", "setDialogueLift", "value", lift)
+}
+
+// SetSubwooferVolume sets the subwoofer volume.
+func (z *Zone) SetSubwooferVolume(volume int8) (err error) {
+	return z.setLevel("subwoofer_volume", "setSubwooferVolume", "volume", volume)
+}
+
+// SetClearVoice enables and disables clear voice.
+func (z *Zone) SetClearVoice(enable bool) (err error) {
+	return z.setEnabled("clear_voice", "setClearVoice", enable)
+}
+
+// SetBassExtension enables and disables bass extension.
+func (z *Zone) SetBassExtension(enable bool) (err error) {
+	return z.setEnabled("bass_extension", "setBassExtension", enable)
+}
+
+// SetEnhancer enables and disables the compressed music enhancer.
+func (z *Zone) SetEnhancer(enable bool) (err error) {
+	return z.setEnabled("enhancer", "setEnhancer", enable)
+}
+
+// SetPureDirect enables and disables pure direct.
+func (z *Zone) SetPureDirect(enable bool) (err error) {
+	return z.setEnabled("pure_direct", "setPureDirect", enable)
+}
+
+// SetExtraBass enables and disables extra bass.
+func (z *Zone) SetExtraBass(enable bool) (err error) {
+	return z.setEnabled("extra_bass", "setExtraBass", enable)
+}
+
+func (z *Zone) setLevel(fn, p, param string, v int8) (err error) {
+	if _, err = z.require(fn); err == nil {
+		if err = z.checkRange(fn, float64(v)); err == nil {
+			params := map[string]interface{}{param: v}
+			err = z.call(p, params)
+		}
+	}
+
+	return err
+}
+
+func (z *Zone) setEnabled(fn, p string, enable bool) (err error) {
+	if _, err = z.require(fn); err == nil {
+		params := map[string]interface{}{"enable": enable}
+		err = z.call(p, params)
+	}
+
+	return err
+}
@@ -0,0 +1,266 @@
+package musiccast
+
+import (
+	"fmt"
+)
+
+const (
+	BandAM     = "am"
+	BandFM     = "fm"
+	BandDAB    = "dab"
+	BandCommon = "common"
+)
+
+const (
+	DirectionNext     = "next"
+	DirectionPrevious = "previous"
+)
+
+const (
+	TuningUp       = "up"
+	TuningDown     = "down"
+	TuningAutoUp   = "auto_up"
+	TuningAutoDown = "auto_down"
+	TuningCancel   = "cancel"
+)
+
+// TunerPlayback is the tuner play info.
+type TunerPlayback struct {
+	Band       string  `json:"band"`
+	AutoScan   bool    `json:"auto_scan"`
+	AutoPreset bool    `json:"auto_preset"`
+	AM         AMInfo  `json:"am"`
+	FM         FMInfo  `json:"fm"`
+	RDS        RDSInfo `json:"rds"`
+	DAB        DABInfo `json:"dab"`
+}
+
+// AMInfo is the AM tuner state, frequencies are in kHz.
+type AMInfo struct {
+	Preset int  `json:"preset"`
+	Freq   int  `json:"freq"`
+	Tuned  bool `json:"tuned"`
+}
+
+// FMInfo is the FM tuner state, frequencies are in kHz.
+type FMInfo struct {
+	Preset    int    `json:"preset"`
+	Freq      int    `json:"freq"`
+	Tuned     bool   `json:"tuned"`
+	AudioMode string `json:"audio_mode"`
+}
+
+// RDSInfo is the FM Radio Data System information.
+type RDSInfo struct {
+	ProgramType    string `json:"program_type"`
+	ProgramService string `json:"program_service"`
+	RadioTextA     string `json:"radio_text_a"`
+	RadioTextB     string `json:"radio_text_b"`
+}
+
+// DABInfo is the DAB tuner state.
+type DABInfo struct {
+	Preset        int    `json:"preset"`
+	ID            int    `json:"id"`
+	Status        string `json:"status"`
+	Freq          int    `json:"freq"`
+	Category      string `json:"category"`
+	AudioMode     string `json:"audio_mode"`
+	BitRate       int    `json:"bit_rate"`
+	Quality       int    `json:"quality"`
+	TuneAid       int    `json:"tune_aid"`
+	OffAir        bool   `json:"off_air"`
+	DABPlus       bool   `json:"dab_plus"`
+	ProgramType   string `json:"program_type"`
+	ChannelLabel  string `json:"ch_label"`
+	ServiceLabel  string `json:"service_label"`
+	DLS           string `json:"dls"`
+	EnsembleLabel string `json:"ensemble_label"`
+}
+
+// TunerPreset is a tuner preset.
+type TunerPreset struct {
+	Band   string `json:"band"`
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+}
+
+// Tuner controls the FM/AM/DAB tuner of a Device.
+type Tuner struct {
+	device *Device
+	zone   string
+}
+
+// Tuner returns the tuner of the device.
+func (d *Device) Tuner() *Tuner {
+	return &Tuner{d, MainZone}
+}
+
+// GetPlayback returns the tuner play info.
+func (t *Tuner) GetPlayback() TunerPlayback {
+	t.device.mutex.RLock()
+	defer t.device.mutex.RUnlock()
+	return t.device.state.Tuner
+}
+
+// GetPresets returns the tuner presets.
+func (t *Tuner) GetPresets() []TunerPreset {
+	t.device.mutex.RLock()
+	defer t.device.mutex.RUnlock()
+	return t.device.state.TunerPresets
+}
+
+// SetBand selects the given band.
+func (t *Tuner) SetBand(band string) (err error) {
+	if _, err = t.require(band); err == nil {
+		params := map[string]interface{}{"band": band}
+		err = t.call("tuner/setBand", params)
+	}
+
+	return err
+}
+
+// SetFrequency tunes the given band to the given frequency in kHz, which must be a step of the band range.
+func (t *Tuner) SetFrequency(band string, freq int) (err error) {
+	features, err := t.require(band)
+	if err == nil {
+		if r, ok := findRange(features.RangeStep, band); ok {
+			if !r.Contains(float64(freq)) {
+				return fmt.Errorf("invalid %s frequency %d, must be between %v and %v", band, freq, r.Min, r.Max)
+			}
+			if r.round(float64(freq)) != float64(freq) {
+				return fmt.Errorf("invalid %s frequency %d, must be a multiple of %v from %v", band, freq, r.Step, r.Min)
+			}
+		}
+		params := map[string]interface{}{"band": band, "tuning": "direct", "num": freq}
+		err = t.call("tuner/setFreq", params)
+	}
+
+	return err
+}
+
+// Tune tunes the given band "up", "down", "auto_up" or "auto_down", or cancels tuning.
+func (t *Tuner) Tune(band, tuning string) (err error) {
+	if _, err = t.require(band); err == nil {
+		params := map[string]interface{}{"band": band, "tuning": tuning}
+		err = t.call("tuner/setFreq", params)
+	}
+
+	return err
+}
+
+// RecallPreset tunes to the preset of the given band with the given number, starting at 1.
+func (t *Tuner) RecallPreset(band string, num int) (err error) {
+	if err = t.checkPreset(num); err == nil {
+		params := map[string]interface{}{"zone": t.zone, "band": band, "num": num}
+		err = t.call("tuner/recallPreset", params)
+	}
+
+	return err
+}
+
+// SwitchPreset tunes to the "next" or "previous" preset.
+func (t *Tuner) SwitchPreset(dir string) (err error) {
+	if _, err = t.require(); err == nil {
+		params := map[string]interface{}{"dir": dir}
+		err = t.call("tuner/switchPreset", params)
+	}
+
+	return err
+}
+
+// StorePreset stores the current station as the preset with the given number, starting at 1.
+func (t *Tuner) StorePreset(num int) (err error) {
+	if err = t.checkPreset(num); err == nil {
+		params := map[string]interface{}{"num": num}
+		err = t.call("tuner/storePreset", params)
+	}
+
+	return err
+}
+
+// SetDABService selects the "next" or "previous" DAB service.
+func (t *Tuner) SetDABService(dir string) (err error) {
+	if _, err = t.require(BandDAB); err == nil {
+		params := map[string]interface{}{"dir": dir}
+		err = t.call("tuner/setDabService", params)
+	}
+
+	return err
+}
+
+// require returns the tuner capabilities or an error unless the tuner supports all the given functions.
+func (t *Tuner) require(funcs ...string) (features TunerFeatures, err error) {
+	f := t.device.GetFeatures().Tuner
+	if f == nil {
+		return features, unsupported("tuner")
+	}
+	for _, fn := range funcs {
+		if !contains(f.FuncList, fn) {
+			return *f, unsupported("tuner " + fn)
+		}
+	}
+	return *f, nil
+}
+
+func (t *Tuner) checkPreset(num int) (err error) {
+	features, err := t.require()
+	if err == nil && (num < 1 || (features.Preset.Num > 0 && num > features.Preset.Num)) {
+		err = fmt.Errorf("invalid preset %d", num)
+	}
+
+	return err
+}
+
+func (t *Tuner) call(p string, params map[string]interface{}) (err error) {
+	resp, err := t.device.requestWithParams("GET", p, params)
+	if err == nil {
+		_, err = decodeResponse(resp)
+	}
+
+	return err
+}
+
+func (d *Device) fetchTunerPlayback() (err error) {
+	resp, err := d.request("GET", "tuner/getPlayInfo")
+	if err == nil {
+		var data map[string]interface{}
+		data, err = decodeResponse(resp)
+		if err == nil {
+			var playback TunerPlayback
+			err = updateIn(&playback, data)
+			if err == nil {
+				d.state.Tuner = playback
+			}
+		}
+	}
+
+	return err
+}
+
+func (d *Device) fetchTunerPresets() (err error) {
+	band := BandCommon
+	if d.features.Tuner != nil && d.features.Tuner.Preset.Type != "" && d.features.Tuner.Preset.Type != BandCommon {
+		band = d.state.Tuner.Band
+		if band == "" {
+			band = BandFM
+		}
+	}
+	params := map[string]interface{}{"band": band}
+	resp, err := d.requestWithParams("GET", "tuner/getPresetInfo", params)
+	if err == nil {
+		var data map[string]interface{}
+		data, err = decodeResponse(resp)
+		if err == nil {
+			var info struct {
+				Presets []TunerPreset `json:"preset_info"`
+			}
+			err = updateIn(&info, data)
+			if err == nil {
+				d.state.TunerPresets = info.Presets
+			}
+		}
+	}
+
+	return err
+}
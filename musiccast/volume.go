@@ -0,0 +1,108 @@
+package musiccast
+
+import (
+	"fmt"
+	"math"
+)
+
+const VolumeModeDB = "db"
+
+// ActualVolume is the volume as displayed by the device, in dB on most receivers.
+type ActualVolume struct {
+	Mode  string  `json:"mode"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+// GetVolumeDB returns the volume in dB.
+func (z *Zone) GetVolumeDB() (db float64, err error) {
+	if _, err = z.requireDB(); err != nil {
+		return db, err
+	}
+	volume := z.GetStatus().ActualVolume
+	if volume.Mode != VolumeModeDB {
+		return db, fmt.Errorf("volume of zone %s not in dB", z.id)
+	}
+	return volume.Value, nil
+}
+
+// SetVolumeDB sets the volume in dB, rounded to the nearest step.
+func (z *Zone) SetVolumeDB(db float64) (err error) {
+	zf, err := z.requireDB()
+	if err == nil {
+		if r, ok := zf.Range("actual_volume_db"); ok {
+			if !r.Contains(db) {
+				return fmt.Errorf("invalid volume %v dB, must be between %v and %v", db, r.Min, r.Max)
+			}
+			db = r.round(db)
+		}
+		params := map[string]interface{}{"mode": VolumeModeDB, "value": db}
+		err = z.call("setActualVolume", params)
+	}
+
+	return err
+}
+
+// GetVolumePercent returns the volume as a percentage of the volume range.
+func (z *Zone) GetVolumePercent() float64 {
+	r := z.volumeRange()
+	if r.Max <= r.Min {
+		return 0
+	}
+	return (float64(z.GetStatus().Volume) - r.Min) / (r.Max - r.Min) * 100
+}
+
+// SetVolumePercent sets the volume to the given percentage of the volume range, rounded to the nearest step.
+func (z *Zone) SetVolumePercent(percent float64) (err error) {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("invalid volume %v%%, must be between 0 and 100", percent)
+	}
+	r := z.volumeRange()
+	return z.SetVolume(uint8(r.round(r.Min + percent/100*(r.Max-r.Min))))
+}
+
+// GetVolumeDB returns the main zone volume in dB.
+func (d *Device) GetVolumeDB() (db float64, err error) {
+	return d.zone(MainZone).GetVolumeDB()
+}
+
+// SetVolumeDB sets the main zone volume in dB.
+func (d *Device) SetVolumeDB(db float64) (err error) {
+	return d.zone(MainZone).SetVolumeDB(db)
+}
+
+// GetVolumePercent returns the main zone volume as a percentage.
+func (d *Device) GetVolumePercent() float64 {
+	return d.zone(MainZone).GetVolumePercent()
+}
+
+// SetVolumePercent sets the main zone volume to the given percentage.
+func (d *Device) SetVolumePercent(percent float64) (err error) {
+	return d.zone(MainZone).SetVolumePercent(percent)
+}
+
+func (z *Zone) requireDB() (zf ZoneFeatures, err error) {
+	zf, err = z.require("actual_volume")
+	if err == nil && len(zf.ActualVolumeModeList) > 0 && !contains(zf.ActualVolumeModeList, VolumeModeDB) {
+		err = unsupported(fmt.Sprintf("dB volume in zone %s", z.id))
+	}
+
+	return zf, err
+}
+
+// volumeRange returns the volume range of the zone, which defaults to the maximum volume reported by the zone status.
+func (z *Zone) volumeRange() RangeStep {
+	zf, _ := z.features()
+	if r, ok := zf.Range("volume"); ok {
+		return r
+	}
+	return RangeStep{ID: "volume", Max: float64(z.GetStatus().MaxVolume), Step: 1}
+}
+
+// round rounds the value to the nearest step of the range.
+func (r RangeStep) round(v float64) float64 {
+	if r.Step > 0 {
+		v = r.Min + math.Round((v-r.Min)/r.Step)*r.Step
+	}
+	return math.Max(r.Min, math.Min(r.Max, v))
+}
@@ -0,0 +1,238 @@
+package musiccast
+
+import (
+	"fmt"
+	"path"
+	"sort"
+)
+
+const (
+	MainZone = "main"
+	Zone2    = "zone2"
+	Zone3    = "zone3"
+	Zone4    = "zone4"
+)
+
+const (
+	PowerOn      = "on"
+	PowerStandby = "standby"
+	PowerToggle  = "toggle"
+)
+
+const (
+	InputNetRadio  = "net_radio"
+	InputServer    = "server"
+	InputSpotify   = "spotify"
+	InputAirPlay   = "airplay"
+	InputBluetooth = "bluetooth"
+	InputUSB       = "usb"
+	InputTuner     = "tuner"
+	InputCD        = "cd"
+	InputTV        = "tv"
+	InputHDMI1     = "hdmi1"
+	InputHDMI2     = "hdmi2"
+	InputHDMI3     = "hdmi3"
+	InputHDMI4     = "hdmi4"
+	InputAV1       = "av1"
+	InputAV2       = "av2"
+	InputAudio1    = "audio1"
+	InputAudio2    = "audio2"
+	InputAUX       = "aux"
+	InputOptical   = "optical"
+	InputCoaxial   = "coaxial"
+	InputPhono     = "phono"
+	InputMCLink    = "mc_link"
+)
+
+// sleepValues are the sleep timer values in minutes accepted by the devices.
+var sleepValues = []uint8{0, 30, 60, 90, 120}
+
+// Zone is an independently controlled output of a Device.
+type Zone struct {
+	device *Device
+	id     string
+}
+
+// Zone returns the zone with the given id, or nil if the device has no such zone.
+func (d *Device) Zone(id string) *Zone {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if _, ok := d.state.Zones[id]; !ok {
+		return nil
+	}
+	return d.zone(id)
+}
+
+// Zones returns the zones of the device, starting with the main zone.
+func (d *Device) Zones() (zones []*Zone) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	ids := make([]string, 0, len(d.state.Zones))
+	for id := range d.state.Zones {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		zones = append(zones, d.zone(id))
+	}
+	return zones
+}
+
+// GetZoneID returns the zone id.
+func (z *Zone) GetZoneID() string {
+	return z.id
+}
+
+// GetDevice returns the device the zone belongs to.
+func (z *Zone) GetDevice() *Device {
+	return z.device
+}
+
+// GetStatus returns the zone status state.
+func (z *Zone) GetStatus() Status {
+	z.device.mutex.RLock()
+	defer z.device.mutex.RUnlock()
+	return z.device.state.Zones[z.id]
+}
+
+// SetVolume sets the volume to the given value.
+func (z *Zone) SetVolume(volume uint8) (err error) {
+	if _, err = z.require("volume"); err == nil {
+		if err = z.checkRange("volume", float64(volume)); err == nil {
+			params := map[string]interface{}{"volume": volume}
+			err = z.call("setVolume", params)
+		}
+	}
+
+	return err
+}
+
+// IncreaseVolume increases the volume by the given value.
+func (z *Zone) IncreaseVolume(step uint8) (err error) {
+	if _, err = z.require("volume"); err == nil {
+		params := map[string]interface{}{"volume": "up", "step": step}
+		err = z.call("setVolume", params)
+	}
+
+	return err
+}
+
+// DecreaseVolume decreases the volume by the given value.
+func (z *Zone) DecreaseVolume(step uint8) (err error) {
+	if _, err = z.require("volume"); err == nil {
+		params := map[string]interface{}{"volume": "down", "step": step}
+		err = z.call("setVolume", params)
+	}
+
+	return err
+}
+
+// SetMute mutes and unmutes the volume.
+func (z *Zone) SetMute(mute bool) (err error) {
+	if _, err = z.require("mute"); err == nil {
+		params := map[string]interface{}{"enable": mute}
+		err = z.call("setMute", params)
+	}
+
+	return err
+}
+
+// SetPower sets the power to "on", "standby" or "toggle".
+func (z *Zone) SetPower(power string) (err error) {
+	if power != PowerOn && power != PowerStandby && power != PowerToggle {
+		return fmt.Errorf("invalid power %s", power)
+	}
+	if _, err = z.require("power"); err == nil {
+		params := map[string]interface{}{"power": power}
+		err = z.call("setPower", params)
+	}
+
+	return err
+}
+
+// SetSleep sets the sleep timer to 0, 30, 60, 90 or 120 minutes.
+func (z *Zone) SetSleep(minutes uint8) (err error) {
+	if _, err = z.require("sleep"); err != nil {
+		return err
+	}
+	for _, v := range sleepValues {
+		if v == minutes {
+			params := map[string]interface{}{"sleep": minutes}
+			return z.call("setSleep", params)
+		}
+	}
+	return fmt.Errorf("invalid sleep timer %d", minutes)
+}
+
+// SetInput selects the given input.
+func (z *Zone) SetInput(input string) (err error) {
+	if err = z.checkInput(input); err == nil {
+		params := map[string]interface{}{"input": input}
+		err = z.call("setInput", params)
+	}
+
+	return err
+}
+
+// PrepareInputChange lets the device prepare for switching to the given input.
+func (z *Zone) PrepareInputChange(input string) (err error) {
+	if _, err = z.require("prepare_input_change"); err == nil {
+		err = z.checkInput(input)
+	}
+	if err == nil {
+		params := map[string]interface{}{"input": input}
+		err = z.call("prepareInputChange", params)
+	}
+
+	return err
+}
+
+// SetSoundProgram selects the given sound program.
+func (z *Zone) SetSoundProgram(program string) (err error) {
+	zf, err := z.require("sound_program")
+	if err == nil {
+		if !contains(zf.SoundProgramList, program) {
+			err = unsupported(fmt.Sprintf("sound program %s in zone %s", program, z.id))
+		} else {
+			params := map[string]interface{}{"program": program}
+			err = z.call("setSoundProgram", params)
+		}
+	}
+
+	return err
+}
+
+// Subscribe returns a channel for receiving update notifications from the zone.
+func (z *Zone) Subscribe() chan interface{} {
+	return broker.Sub(zoneTopic(z.device.id, z.id))
+}
+
+func (z *Zone) call(p string, params map[string]interface{}) (err error) {
+	resp, err := z.device.requestWithParams("GET", path.Join(z.id, p), params)
+	if err == nil {
+		_, err = decodeResponse(resp)
+	}
+
+	return err
+}
+
+func (z *Zone) features() (ZoneFeatures, bool) {
+	return z.device.GetFeatures().Zone(z.id)
+}
+
+func (z *Zone) checkInput(input string) (err error) {
+	zf, err := z.require()
+	if err == nil && !contains(zf.InputList, input) {
+		err = unsupported(fmt.Sprintf("input %s in zone %s", input, z.id))
+	}
+
+	return err
+}
+
+func (d *Device) zone(id string) *Zone {
+	return &Zone{d, id}
+}
+
+func zoneTopic(deviceID, zone string) string {
+	return deviceID + "/" + zone
+}